@@ -0,0 +1,130 @@
+package latex
+
+import (
+	"bytes"
+	"strings"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// Attributes use the Pandoc syntax, e.g. `{#id .class key=value}`. The lone
+// `-` is a shorthand for the `unnumbered` class.
+type attributes struct {
+	id      string
+	classes []string
+	values  map[string]string
+}
+
+func (a attributes) hasClass(class string) bool {
+	for _, c := range a.classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func (a attributes) unnumbered() bool {
+	return a.hasClass("unnumbered")
+}
+
+// Merge b into a. Identifiers and values of b take precedence.
+func (a attributes) merge(b attributes) attributes {
+	if b.id != "" {
+		a.id = b.id
+	}
+	a.classes = append(a.classes, b.classes...)
+	for k, v := range b.values {
+		if a.values == nil {
+			a.values = map[string]string{}
+		}
+		a.values[k] = v
+	}
+	return a
+}
+
+// Parse the content of an attribute block, braces excluded.
+func parseAttributes(text string) attributes {
+	var a attributes
+	for _, field := range splitFields(text) {
+		switch {
+		case field == "-":
+			a.classes = append(a.classes, "unnumbered")
+		case strings.HasPrefix(field, "#"):
+			a.id = field[1:]
+		case strings.HasPrefix(field, "."):
+			a.classes = append(a.classes, field[1:])
+		case strings.Contains(field, "="):
+			if a.values == nil {
+				a.values = map[string]string{}
+			}
+			kv := strings.SplitN(field, "=", 2)
+			a.values[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return a
+}
+
+// Split on spaces, except within double quotes.
+func splitFields(text string) []string {
+	var fields []string
+	quoted := false
+	start := -1
+	for i, c := range text {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			if start < 0 {
+				start = i
+			}
+		case (c == ' ' || c == '\t') && !quoted:
+			if start >= 0 {
+				fields = append(fields, text[start:i])
+				start = -1
+			}
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, text[start:])
+	}
+	return fields
+}
+
+// Split a trailing attribute block off text. The returned text is trimmed of
+// the spaces preceding the block.
+func splitAttributes(text []byte) ([]byte, attributes, bool) {
+	trimmed := bytes.TrimRight(text, " \t")
+	if !bytes.HasSuffix(trimmed, []byte("}")) {
+		return text, attributes{}, false
+	}
+	start := bytes.LastIndexByte(trimmed, '{')
+	if start < 0 {
+		return text, attributes{}, false
+	}
+	block := string(trimmed[start+1 : len(trimmed)-1])
+	if block == "" || !(strings.IndexByte("#.-", block[0]) >= 0 || strings.Contains(block, "=")) {
+		return text, attributes{}, false
+	}
+	return bytes.TrimRight(trimmed[:start], " \t"), parseAttributes(block), true
+}
+
+// Return the attributes of a heading: those found at the end of its text, and
+// those blackfriday's HeadingIDs extension caught in the heading ID.
+func headingAttributes(heading *bf.Node) attributes {
+	var a attributes
+	if strings.ContainsAny(heading.HeadingID, " \t") {
+		a = parseAttributes("#" + heading.HeadingID)
+	} else if heading.HeadingID != "" {
+		a.id = heading.HeadingID
+	}
+	if last := heading.LastChild; last != nil && last.Type == bf.Text {
+		if _, b, ok := splitAttributes(last.Literal); ok {
+			a = a.merge(b)
+		}
+	}
+	return a
+}
@@ -0,0 +1,91 @@
+package latex
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Author is an author of the document.
+type Author struct {
+	Name        string
+	Affiliation string
+	Email       string
+
+	// ORCID is the ORCID identifier of the author, e.g. "0000-0002-1825-0097".
+	ORCID string
+
+	// Corresponding marks the author to whom correspondence is addressed.
+	Corresponding bool
+}
+
+// TemplateAuthor is an author as passed to the templates, escaped.
+type TemplateAuthor struct {
+	Name string
+
+	// Affiliation is the number of the author's affiliation, 0 for none.
+	Affiliation int
+
+	// Thanks is the footnote with the email and ORCID of the author, and
+	// whether the author is the corresponding one. It is empty if there is
+	// nothing to say.
+	Thanks string
+}
+
+// Affiliation is an affiliation shared by one or more authors.
+type Affiliation struct {
+	Number int
+	Name   string
+}
+
+// The authors of the document, ready for the templates.
+type templateAuthors struct {
+	authors      []TemplateAuthor
+	affiliations []Affiliation
+
+	// The names for the PDF metadata.
+	pdf []string
+}
+
+// Escape the authors and number their affiliations. Authors sharing an
+// affiliation share its number.
+func (r *Renderer) templateAuthors(authors []Author) templateAuthors {
+	var result templateAuthors
+	numbers := map[string]int{}
+	for _, a := range authors {
+		author := TemplateAuthor{Name: r.inlineMeta(a.Name), Thanks: r.thanks(a)}
+		if a.Affiliation != "" {
+			if numbers[a.Affiliation] == 0 {
+				numbers[a.Affiliation] = len(numbers) + 1
+				result.affiliations = append(result.affiliations, Affiliation{
+					Number: numbers[a.Affiliation],
+					Name:   r.inlineMeta(a.Affiliation),
+				})
+			}
+			author.Affiliation = numbers[a.Affiliation]
+		}
+		result.authors = append(result.authors, author)
+
+		result.pdf = append(result.pdf, string(r.escPDF([]byte(a.Name))))
+	}
+	return result
+}
+
+// Return the footnote of an author: whether the author is the corresponding
+// one, and the email and ORCID as links.
+func (r *Renderer) thanks(a Author) string {
+	var parts []string
+	if a.Corresponding {
+		parts = append(parts, "Corresponding author")
+	}
+	if a.Email != "" {
+		var w bytes.Buffer
+		escapeURL(&w, []byte("mailto:"+a.Email))
+		parts = append(parts, `\href{`+w.String()+`}{`+r.escapeMeta(a.Email)+`}`)
+	}
+	if a.ORCID != "" {
+		var w bytes.Buffer
+		escapeURL(&w, []byte("https://orcid.org/"+a.ORCID))
+		parts = append(parts, `ORCID \href{`+w.String()+`}{`+r.escapeMeta(a.ORCID)+`}`)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,77 @@
+package latex
+
+import (
+	"bytes"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// Return the caption of a table: with the TableCaptions flag, the paragraph
+// that follows it and starts with "Table:" or ":", as in Pandoc. It is nil if
+// the table has no caption.
+func (r *Renderer) captionParagraph(table *bf.Node) *bf.Node {
+	p := table.Next
+	if r.Flags&TableCaptions == 0 || p == nil || p.Type != bf.Paragraph || p.FirstChild == nil || p.FirstChild.Type != bf.Text {
+		return nil
+	}
+	text := p.FirstChild.Literal
+	if bytes.HasPrefix(text, []byte("Table:")) || bytes.HasPrefix(text, []byte(": ")) {
+		return p
+	}
+	return nil
+}
+
+// Report whether a paragraph is the caption of a table.
+func (r *Renderer) isTableCaption(p *bf.Node) bool {
+	return p.Prev != nil && p.Prev.Type == bf.Table && r.captionParagraph(p.Prev) == p
+}
+
+// Render the caption of a table, without its prefix.
+func (r *Renderer) tableCaption(caption *bf.Node) []byte {
+	text := r.renderChildrenIn(inCaption, caption)
+	if !bytes.HasPrefix(text, []byte("Table:")) {
+		text = text[1:]
+	} else {
+		text = text[len("Table:"):]
+	}
+	return bytes.TrimSpace(text)
+}
+
+// Return the caption of a code block, from its caption attribute.
+func (r *Renderer) codeCaption(attrs attributes) []byte {
+	caption := attrs.values["caption"]
+	if caption == "" {
+		return nil
+	}
+	var w bytes.Buffer
+	escapeCaption(&w, []byte(caption))
+	return r.unicode(w.Bytes())
+}
+
+// Report whether the document has tables with a caption.
+func (r *Renderer) hasTables(ast *bf.Node) bool {
+	result := false
+	ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if node.Type == bf.Table && r.captionParagraph(node) != nil {
+			result = true
+			return bf.Terminate
+		}
+		return bf.GoToNext
+	})
+	return result
+}
+
+// Report whether the document has code blocks with a caption.
+func hasListings(ast *bf.Node) bool {
+	result := false
+	ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if node.Type == bf.CodeBlock {
+			if _, attrs := codeInfo(node.Info); attrs.values["caption"] != "" {
+				result = true
+				return bf.Terminate
+			}
+		}
+		return bf.GoToNext
+	})
+	return result
+}
@@ -0,0 +1,138 @@
+package latex
+
+import "strconv"
+
+// DocumentClass is the LaTeX document class of the generated document. It
+// also decides how Markdown heading levels map to sectioning commands.
+type DocumentClass string
+
+// Supported document classes. The zero value renders like ClassArticle, except
+// that the ChapterTitle flag keeps using `\chapter`. Other classes are reported
+// by Warnings and replaced by ClassArticle.
+const (
+	ClassArticle     DocumentClass = "article"
+	ClassReport      DocumentClass = "report"
+	ClassBook        DocumentClass = "book"
+	ClassMemoir      DocumentClass = "memoir"
+	ClassKOMAArticle DocumentClass = "scrartcl"
+	ClassKOMAReport  DocumentClass = "scrreprt"
+	ClassKOMABook    DocumentClass = "scrbook"
+	ClassBeamer      DocumentClass = "beamer"
+)
+
+// Pseudo sectioning command for beamer slides.
+const frameCommand = "frame"
+
+type classProfile struct {
+	// Sectioning commands, starting from the one used by level 1 headings.
+	sections []string
+
+	// Command used for the title when ChapterTitle is on.
+	titleCommand string
+
+	koma   bool
+	beamer bool
+
+	// The class has `\frontmatter`, `\mainmatter` and `\backmatter`.
+	matter bool
+}
+
+// Report whether the class has chapters.
+func (p classProfile) chapters() bool {
+	for _, command := range p.sections {
+		if command == "chapter" {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	articleSections = []string{"section", "subsection", "subsubsection", "paragraph", "subparagraph"}
+	bookSections    = []string{"chapter", "section", "subsection", "subsubsection", "paragraph", "subparagraph"}
+)
+
+var classProfiles = map[DocumentClass]classProfile{
+	"":               {sections: articleSections, titleCommand: "chapter"},
+	ClassArticle:     {sections: articleSections, titleCommand: "part"},
+	ClassReport:      {sections: bookSections, titleCommand: "part"},
+	ClassBook:        {sections: bookSections, titleCommand: "part", matter: true},
+	ClassMemoir:      {sections: []string{"part", "chapter", "section", "subsection", "subsubsection", "paragraph"}, titleCommand: "book", matter: true},
+	ClassKOMAArticle: {sections: articleSections, titleCommand: "part", koma: true},
+	ClassKOMAReport:  {sections: bookSections, titleCommand: "part", koma: true},
+	ClassKOMABook:    {sections: bookSections, titleCommand: "part", koma: true, matter: true},
+	ClassBeamer:      {sections: []string{"section", frameCommand}, titleCommand: "part", beamer: true},
+}
+
+// Return the document class requested by the renderer, or else by the
+// metadata. It may be unknown.
+func (r *Renderer) requestedClass() DocumentClass {
+	if r.DocumentClass != "" {
+		return r.DocumentClass
+	}
+	return DocumentClass(r.Metadata.DocumentClass)
+}
+
+// Return the document class of the renderer. Unknown classes are replaced by
+// article, and reported by RenderHeader.
+func (r *Renderer) documentClass() DocumentClass {
+	class := r.requestedClass()
+	if _, ok := classProfiles[class]; !ok {
+		return ClassArticle
+	}
+	return class
+}
+
+// Return the profile of the renderer document class.
+func (r *Renderer) class() classProfile {
+	return classProfiles[r.documentClass()]
+}
+
+// Return the sectioning command for a heading level, or the empty string if
+// the class has no command for it.
+func (p classProfile) section(level int) string {
+	if level < 1 || level > len(p.sections) {
+		return ""
+	}
+	return p.sections[level-1]
+}
+
+// Run-in headings are followed by the paragraph text on the same line.
+func isRunIn(command string) bool {
+	return command == "" || command == "paragraph" || command == "subparagraph"
+}
+
+// LaTeX levels of the sectioning commands, as used by the tocdepth and
+// secnumdepth counters. Parts are at level 0 in classes without chapters.
+var sectionLevels = map[string]int{
+	"book":          -2,
+	"part":          -1,
+	"chapter":       0,
+	"section":       1,
+	"subsection":    2,
+	"subsubsection": 3,
+	"paragraph":     4,
+	"subparagraph":  5,
+}
+
+// Return the LaTeX level of the sectioning command of a Markdown heading
+// level, as a counter value. Levels without a command take the level of the
+// deepest command above them. It is empty for a zero level.
+func (r *Renderer) depth(level int) string {
+	if level == 0 {
+		return ""
+	}
+	chapters := r.class().chapters()
+	for ; level > 0; level-- {
+		command := r.sectionCommand(level)
+		n, ok := sectionLevels[command]
+		if !ok {
+			continue
+		}
+		if command == "part" && !chapters {
+			n = 0
+		}
+		return strconv.Itoa(n)
+	}
+	return ""
+}
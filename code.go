@@ -0,0 +1,102 @@
+package latex
+
+import "strings"
+
+// CodeEngine selects how code spans and code blocks are typeset.
+type CodeEngine int
+
+const (
+	// CodeListings uses the `listings` package.
+	CodeListings CodeEngine = iota
+
+	// CodeMinted uses the `minted` package. Highlighting is done by Pygments,
+	// so the document must be compiled with `-shell-escape`.
+	CodeMinted
+
+	// CodeVerbatim uses the `fancyvrb` package, without highlighting.
+	CodeVerbatim
+
+	// CodeHighlight highlights code in the renderer and typesets it with
+	// `fancyvrb` and `\textcolor`. It needs no external tool.
+	CodeHighlight
+)
+
+// Render a code span.
+func (r *Renderer) code(literal []byte) {
+	var command string
+	switch {
+	case r.CodeEngine == CodeHighlight || r.fragile():
+		// Verbatim commands cannot be used in arguments.
+		r.w.WriteString(`\texttt{`)
+		r.escCode(literal)
+		r.w.WriteByte('}')
+		return
+	case r.CodeEngine == CodeMinted:
+		command = `\mintinline{text}`
+	case r.CodeEngine == CodeVerbatim:
+		command = `\Verb`
+	default:
+		command = `\lstinline`
+	}
+
+	// Inline verbatim commands need an ASCII delimiter that is not in the node
+	// content.
+	// TODO: Find a more elegant fallback for when the code lists all ASCII characters.
+	delimiter := getDelimiter(literal)
+	r.w.WriteString(command)
+	if delimiter != 0 {
+		r.w.WriteByte(delimiter)
+		r.w.Write(literal)
+		r.w.WriteByte(delimiter)
+	} else {
+		r.w.WriteString("!<RENDERING ERROR: no delimiter found>!")
+	}
+}
+
+// Render a code block. Only listings gives code blocks a caption.
+func (r *Renderer) codeBlock(lang, literal []byte, attrs attributes) {
+	if r.fragile() {
+		r.robustCodeBlock(literal)
+		return
+	}
+	switch r.CodeEngine {
+	case CodeMinted:
+		if len(lang) == 0 {
+			lang = []byte("text")
+		}
+		r.w.WriteString(`\begin{minted}{`)
+		r.w.Write(lang)
+		r.w.WriteString("}\n")
+		r.w.Write(literal)
+		r.env("minted", false)
+	case CodeVerbatim:
+		r.env("Verbatim", true)
+		r.w.Write(literal)
+		r.env("Verbatim", false)
+	case CodeHighlight:
+		r.w.WriteString(`\begin{Verbatim}[commandchars=\\\{\}]` + "\n")
+		highlight(&r.w, string(lang), literal)
+		r.env("Verbatim", false)
+	default:
+		var options []string
+		if name := listingsLanguage(string(lang)); strings.HasPrefix(name, "[") {
+			// Dialects such as "[Sharp]C" hold a bracket that would end the
+			// options.
+			options = append(options, "language={"+name+"}")
+		} else if name != "" {
+			options = append(options, "language="+name)
+		} else if len(lang) != 0 {
+			r.warn("unknown code language %q", lang)
+		}
+		if caption := r.codeCaption(attrs); caption != nil {
+			options = append(options, "caption={"+string(caption)+"}")
+		}
+		r.w.WriteString(`\begin{lstlisting}`)
+		if len(options) != 0 {
+			r.w.WriteString("[" + strings.Join(options, ", ") + "]")
+		}
+		r.w.WriteByte('\n')
+		r.w.Write(literal)
+		r.env("lstlisting", false)
+	}
+}
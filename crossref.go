@@ -0,0 +1,271 @@
+package latex
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// CrossRefStyle selects how links to a label of the same document, e.g.
+// `[Introduction](#introduction)`, are rendered.
+type CrossRefStyle int
+
+const (
+	// CrossRefHyperref links the text to the label with `\hyperref`. Bare
+	// references render as `\ref`.
+	CrossRefHyperref CrossRefStyle = iota
+
+	// CrossRefRef keeps the text and appends the number with `\ref`, e.g.
+	// "Section~\ref{sec:introduction}".
+	CrossRefRef
+
+	// CrossRefAutoref replaces the text with `\autoref`, which prints both the
+	// kind of the target and its number.
+	CrossRefAutoref
+)
+
+// Return a label that is safe to use in `\label` and `\ref`. Non-ASCII
+// characters are spelled out; distinct identifiers may still give the same
+// label, which collectLabels makes unique.
+func sanitizeLabel(id string) string {
+	var b strings.Builder
+	for _, c := range id {
+		switch {
+		case c < utf8.RuneSelf && (isalnum(byte(c)) || strings.IndexByte("-:._", byte(c)) >= 0):
+			b.WriteRune(c)
+		case c < utf8.RuneSelf:
+			b.WriteByte('-')
+		default:
+			fmt.Fprintf(&b, "u%x", c)
+		}
+	}
+	return b.String()
+}
+
+// Return the label of a heading identifier. Identifiers that already carry a
+// prefix, e.g. `{#sec:intro}`, are kept as is.
+func headingLabel(id string) string {
+	label := sanitizeLabel(id)
+	if !strings.Contains(label, ":") {
+		label = "sec:" + label
+	}
+	return label
+}
+
+// Return the label of an equation identifier.
+func equationLabel(id string) string {
+	label := sanitizeLabel(id)
+	if !strings.Contains(label, ":") {
+		label = "eq:" + label
+	}
+	return label
+}
+
+type label struct {
+	name     string
+	equation bool
+}
+
+// Return the label of an identifier of the document, as given by
+// collectLabels.
+func (r *Renderer) label(id string, fallback func(string) string) string {
+	if l, ok := r.labels[id]; ok {
+		return l.name
+	}
+	return fallback(id)
+}
+
+// Map the identifiers of the document to their labels. Identifiers that give
+// a label already taken, e.g. "a b" and "a-b", get a numbered suffix.
+func collectLabels(ast *bf.Node) map[string]label {
+	labels := map[string]label{}
+	used := map[string]bool{}
+	unique := func(name string) string {
+		n := name
+		for i := 2; used[n]; i++ {
+			n = name + "-" + strconv.Itoa(i)
+		}
+		used[n] = true
+		return n
+	}
+	ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		switch {
+		case node.Type == bf.Heading && entering && !node.IsTitleblock:
+			if id := headingAttributes(node).id; id != "" {
+				if _, ok := labels[id]; !ok {
+					labels[id] = label{name: unique(headingLabel(id))}
+				}
+			}
+			return bf.SkipChildren
+		case node.Type == bf.CodeBlock:
+			lang, attrs := codeInfo(node.Info)
+			if _, ok := labels[attrs.id]; string(lang) == "math" && attrs.id != "" && !attrs.unnumbered() && !ok {
+				labels[attrs.id] = label{name: unique(equationLabel(attrs.id)), equation: true}
+			}
+		}
+		return bf.GoToNext
+	})
+	return labels
+}
+
+// Write a reference to a label without text.
+func (r *Renderer) ref(l label) {
+	switch {
+	case r.CrossRefs == CrossRefAutoref:
+		r.w.WriteString(`\autoref{` + l.name + `}`)
+	case l.equation:
+		r.w.WriteString(`\eqref{` + l.name + `}`)
+	default:
+		r.w.WriteString(`\ref{` + l.name + `}`)
+	}
+}
+
+// Render a link to a fragment of the document. Unknown targets are reported
+// and only their text is rendered.
+func (r *Renderer) crossRef(node *bf.Node) {
+	fragment := string(node.LinkData.Destination[1:])
+	l, ok := r.labels[fragment]
+	if !ok {
+		r.warn("unresolved link target %q", "#"+fragment)
+		r.w.Write(r.renderChildren(node))
+		return
+	}
+
+	// A link whose text is its destination, e.g. `[#intro](#intro)`, or whose
+	// text is blank, e.g. `[ ](#intro)`, stands for the bare reference.
+	// Blackfriday leaves `[](#intro)` as plain text, which text resolves.
+	var text []byte
+	if c := node.FirstChild; c == nil || c.Next != nil || c.Type != bf.Text || !bytes.Equal(c.Literal, node.LinkData.Destination) {
+		text = r.renderChildren(node)
+	}
+
+	switch {
+	case len(bytes.TrimSpace(text)) == 0 || r.CrossRefs == CrossRefAutoref:
+		r.ref(l)
+	case r.CrossRefs == CrossRefRef:
+		r.w.Write(text)
+		r.w.WriteByte('~')
+		r.ref(l)
+	default:
+		r.w.WriteString(`\hyperref[` + l.name + `]{`)
+		r.w.Write(text)
+		r.w.WriteByte('}')
+	}
+}
+
+// Return the keys of a `[@key]` or `[@key1; @key2]` reference at the start of
+// text and the length of the reference, or a zero length if there is none.
+func parseReference(text []byte) ([]string, int) {
+	if !bytes.HasPrefix(text, []byte("[@")) {
+		return nil, 0
+	}
+	end := bytes.IndexByte(text, ']')
+	if end < 0 {
+		return nil, 0
+	}
+	var keys []string
+	for _, key := range strings.Split(string(text[1:end]), ";") {
+		key = strings.TrimSpace(key)
+		if len(key) < 2 || key[0] != '@' || strings.ContainsAny(key, " \t\n[") {
+			return nil, 0
+		}
+		keys = append(keys, key[1:])
+	}
+	return keys, end + 1
+}
+
+// Return the identifier of a `[](#id)` link at the start of text, which
+// Blackfriday does not parse as a link, and the length of the link, or a zero
+// length if there is none.
+func parseEmptyLink(text []byte) (string, int) {
+	if !bytes.HasPrefix(text, []byte("[](#")) {
+		return "", 0
+	}
+	end := bytes.IndexByte(text, ')')
+	if end <= len("[](#") || bytes.ContainsAny(text[len("[](#"):end], " \t\n") {
+		return "", 0
+	}
+	return string(text[len("[](#"):end]), end + 1
+}
+
+// Render text, replacing `[@label]` references and `[](#label)` links to
+// labels of the document. When the metadata has a bibliography, other
+// references are citations.
+func (r *Renderer) text(text []byte) {
+	org := 0
+	for i := bytes.IndexByte(text, '['); i >= 0 && i < len(text); {
+		if id, n := parseEmptyLink(text[i:]); n != 0 {
+			r.plain(text[org:i])
+			l, ok := r.labels[id]
+			if !ok {
+				r.warn("unresolved link target %q", "#"+id)
+				l.name = r.label(id, headingLabel)
+			}
+			r.ref(l)
+			i += n
+			org = i
+			continue
+		}
+		keys, n := parseReference(text[i:])
+		cite := n != 0 && len(r.Metadata.Bibliography) != 0 && !r.labelled(keys)
+		if n == 0 || !cite && !r.hasLabels(keys) {
+			next := bytes.IndexByte(text[i+1:], '[')
+			if next < 0 {
+				break
+			}
+			i += next + 1
+			continue
+		}
+		r.plain(text[org:i])
+		if cite {
+			r.w.WriteString(`\autocite{` + strings.Join(keys, ",") + `}`)
+		} else {
+			for k, key := range keys {
+				if k > 0 {
+					r.w.WriteString(", ")
+				}
+				r.ref(r.labels[key])
+			}
+		}
+		i += n
+		org = i
+	}
+	r.plain(text[org:])
+}
+
+// Report whether all the keys are labels of the document.
+func (r *Renderer) labelled(keys []string) bool {
+	for _, key := range keys {
+		if _, ok := r.labels[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Renderer) hasLabels(keys []string) bool {
+	for _, key := range keys {
+		if _, ok := r.labels[key]; !ok {
+			r.warn("unresolved reference %q", "@"+key)
+			return false
+		}
+	}
+	return true
+}
+
+// Render text that holds no reference.
+func (r *Renderer) plain(text []byte) {
+	if r.Flags&TeXMath != 0 {
+		r.texMath(text)
+	} else {
+		r.esc(text)
+	}
+}
+
+func isFragment(dest []byte) bool {
+	return len(dest) > 1 && dest[0] == '#'
+}
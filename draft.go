@@ -0,0 +1,53 @@
+package latex
+
+// Draft marks the document for review. It only changes the preamble. The zero
+// value renders the final document.
+type Draft struct {
+	// Watermark is the text set diagonally across the pages, e.g. "DRAFT".
+	Watermark string
+
+	// Revision is the revision of the draft. When set, the pages get a
+	// "DRAFT -- revision -- date" line at the bottom.
+	Revision string
+
+	// Date is the date of the draft line, today if empty.
+	Date string
+
+	// Banner is a label set at the top of the pages, e.g. "CONFIDENTIAL".
+	Banner string
+
+	// LineNumbers numbers the lines of the text with lineno. Presentations
+	// are not numbered.
+	LineNumbers bool
+}
+
+// TemplateDraft is the draft setup as passed to the templates, escaped.
+type TemplateDraft struct {
+	Watermark   string
+	Footer      string
+	Banner      string
+	LineNumbers bool
+}
+
+// Return the draft setup for the templates, or nil for a final document.
+func (r *Renderer) draft(beamer bool) *TemplateDraft {
+	if r.Draft == (Draft{}) {
+		return nil
+	}
+	d := &TemplateDraft{
+		Watermark:   r.escapeMeta(r.Draft.Watermark),
+		Banner:      r.escapeMeta(r.Draft.Banner),
+		LineNumbers: r.Draft.LineNumbers && !beamer,
+	}
+	if r.Draft.Revision != "" {
+		date := `\today`
+		if r.Draft.Date != "" {
+			date = r.escapeMeta(r.Draft.Date)
+		}
+		d.Footer = `DRAFT -- revision ` + r.escapeMeta(r.Draft.Revision) + ` -- ` + date
+	}
+	if *d == (TemplateDraft{}) {
+		return nil
+	}
+	return d
+}
@@ -0,0 +1,108 @@
+package latex
+
+import "strings"
+
+// Engine is the TeX engine the document is compiled with.
+type Engine int
+
+const (
+	// EnginePDFLaTeX loads inputenc and fontenc, and replaces the characters
+	// pdfLaTeX does not know by LaTeX commands.
+	EnginePDFLaTeX Engine = iota
+
+	// EngineXeLaTeX loads fontspec, unicode-math and polyglossia.
+	EngineXeLaTeX
+
+	// EngineLuaLaTeX loads fontspec, unicode-math and polyglossia.
+	EngineLuaLaTeX
+)
+
+// Report whether the engine reads Unicode natively and uses system fonts.
+func (e Engine) unicode() bool {
+	return e == EngineXeLaTeX || e == EngineLuaLaTeX
+}
+
+// A language as polyglossia knows it.
+type polyglossiaLanguage struct {
+	name    string
+	options string
+}
+
+// Babel languages whose polyglossia name differs, indexed by lower-case name.
+var polyglossiaLanguages = map[string]polyglossiaLanguage{
+	"american":     {"english", "variant=american"},
+	"australian":   {"english", "variant=australian"},
+	"austrian":     {"german", "variant=austrian"},
+	"bahasa":       {"malay", ""},
+	"brazil":       {"portuguese", "variant=brazilian"},
+	"brazilian":    {"portuguese", "variant=brazilian"},
+	"british":      {"english", "variant=british"},
+	"canadian":     {"english", "variant=canadian"},
+	"francais":     {"french", ""},
+	"frenchb":      {"french", ""},
+	"magyar":       {"hungarian", ""},
+	"naustrian":    {"german", "variant=austrian, spelling=new"},
+	"newzealand":   {"english", "variant=newzealand"},
+	"nswissgerman": {"german", "variant=swiss, spelling=new"},
+	"ngerman":      {"german", "spelling=new"},
+	"norsk":        {"norwegian", "variant=bokmal"},
+	"nynorsk":      {"norwegian", "variant=nynorsk"},
+	"portuges":     {"portuguese", ""},
+	"swissgerman":  {"german", "variant=swiss"},
+	"ukenglish":    {"english", "variant=british"},
+	"usenglish":    {"english", "variant=american"},
+}
+
+// PolyglossiaLanguage is a language to be set up with polyglossia.
+type PolyglossiaLanguage struct {
+	// Name is the polyglossia name of the language.
+	Name string
+
+	// Options are the language options, e.g. "variant=british".
+	Options string
+
+	// Default is true for the main language of the document.
+	Default bool
+}
+
+// Map the comma-separated babel languages to polyglossia. As with babel, the
+// last language is the main language; it comes first.
+func polyglossia(languages string) []PolyglossiaLanguage {
+	var result []PolyglossiaLanguage
+	seen := map[string]bool{}
+	fields := strings.Split(languages, ",")
+	for i := len(fields) - 1; i >= 0; i-- {
+		name := strings.TrimSpace(fields[i])
+		if name == "" {
+			continue
+		}
+		language := polyglossiaLanguage{name: name}
+		if l, ok := polyglossiaLanguages[strings.ToLower(name)]; ok {
+			language = l
+		}
+		if seen[language.name] {
+			continue
+		}
+		seen[language.name] = true
+		result = append(result, PolyglossiaLanguage{
+			Name:    language.name,
+			Options: language.options,
+			Default: len(result) == 0,
+		})
+	}
+	return result
+}
+
+// Add a secondary language to the polyglossia languages, if missing. English
+// is the main language if there is none.
+func addLanguage(languages []PolyglossiaLanguage, name string) []PolyglossiaLanguage {
+	if len(languages) == 0 {
+		languages = append(languages, PolyglossiaLanguage{Name: "english", Default: true})
+	}
+	for _, l := range languages {
+		if l.Name == name {
+			return languages
+		}
+	}
+	return append(languages, PolyglossiaLanguage{Name: name})
+}
@@ -0,0 +1,217 @@
+package latex
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+)
+
+// Each output context has its own escaper, indexed by the bytes that are
+// special in the context.
+
+// Text of paragraphs, emphasis, headings, etc. Double quotes are handled
+// separately.
+var textEscaper = [256][]byte{
+	'#':  []byte(`\#`),
+	'$':  []byte(`\$`),
+	'%':  []byte(`\%`),
+	'&':  []byte(`\&`),
+	'\\': []byte(`\textbackslash{}`),
+	'_':  []byte(`\_`),
+	'{':  []byte(`\{`),
+	'}':  []byte(`\}`),
+	'~':  []byte(`\textasciitilde{}`),
+	'^':  []byte(`\textasciicircum{}`),
+	'<':  []byte(`\textless{}`),
+	'>':  []byte(`\textgreater{}`),
+	'|':  []byte(`\textbar{}`),
+}
+
+// Code in `\texttt` and plain text in PDF strings.
+var codeEscaper = [256][]byte{
+	'#':  []byte(`\#`),
+	'$':  []byte(`\$`),
+	'%':  []byte(`\%`),
+	'&':  []byte(`\&`),
+	'\\': []byte(`\textbackslash{}`),
+	'_':  []byte(`\_`),
+	'{':  []byte(`\{`),
+	'}':  []byte(`\}`),
+	'~':  []byte(`\textasciitilde{}`),
+	'^':  []byte(`\textasciicircum{}`),
+	'"':  []byte(`\textquotedbl{}`),
+}
+
+// URLs in `\href`, `\url` and `\nolinkurl`. These commands read most
+// characters verbatim, but `%` and `#` must be escaped when the command is in
+// an argument, and braces must be balanced, so they are percent-encoded, as
+// are backslashes and spaces.
+var urlEscaper = [256][]byte{
+	'#':  []byte(`\#`),
+	'%':  []byte(`\%`),
+	'\\': []byte(`\%5C`),
+	'{':  []byte(`\%7B`),
+	'}':  []byte(`\%7D`),
+	' ':  []byte(`\%20`),
+}
+
+// File paths in `\includegraphics`, which are read verbatim in `\detokenize`
+// except for the characters it cannot hold. Backslashes become slashes.
+var pathEscaper = [256][]byte{
+	'#':  []byte(`\#`),
+	'%':  []byte(`\%`),
+	'{':  []byte(`\{`),
+	'}':  []byte(`\}`),
+	'\\': []byte(`/`),
+}
+
+func escape(w *bytes.Buffer, text []byte, escaper *[256][]byte) {
+	org := 0
+	for i, c := range text {
+		if escaper[c] != nil {
+			w.Write(text[org:i])
+			w.Write(escaper[c])
+			org = i + 1
+		}
+	}
+	w.Write(text[org:])
+}
+
+// Escape text. Double quotes become `\enquote`; quoted tells if one is open.
+func escapeText(w *bytes.Buffer, text []byte, quoted *bool) {
+	org := 0
+	for i, c := range text {
+		if c != '"' {
+			continue
+		}
+		escape(w, text[org:i], &textEscaper)
+		if *quoted {
+			w.WriteByte('}')
+		} else {
+			w.WriteString(`\enquote{`)
+		}
+		*quoted = !*quoted
+		org = i + 1
+	}
+	escape(w, text[org:], &textEscaper)
+}
+
+// Escape code for use in `\texttt`.
+func escapeCode(w *bytes.Buffer, text []byte) {
+	escape(w, text, &codeEscaper)
+}
+
+// Escape a URL.
+func escapeURL(w *bytes.Buffer, text []byte) {
+	escape(w, text, &urlEscaper)
+}
+
+// Escape a caption. Quotes are balanced within the caption, and line breaks
+// become spaces.
+func escapeCaption(w *bytes.Buffer, text []byte) {
+	quoted := false
+	escapeText(w, bytes.ReplaceAll(text, []byte("\n"), []byte(" ")), &quoted)
+	if quoted {
+		w.WriteByte('}')
+	}
+}
+
+// Escape a title or an author name given as plain text. Quotes are balanced
+// within the text, and line breaks are kept.
+func escapeTitle(w *bytes.Buffer, text []byte) {
+	quoted := false
+	for i, line := range bytes.Split(bytes.TrimSpace(text), []byte("\n")) {
+		if i > 0 {
+			w.WriteString(`\\` + "\n")
+		}
+		escapeText(w, bytes.TrimSpace(line), &quoted)
+	}
+	if quoted {
+		w.WriteByte('}')
+	}
+}
+
+// Escape plain text for a PDF string, such as a bookmark. Only characters are
+// allowed, so line breaks become spaces.
+func escapePDF(w *bytes.Buffer, text []byte) {
+	escape(w, bytes.ReplaceAll(text, []byte("\n"), []byte(" ")), &codeEscaper)
+}
+
+// Escape a file path for `\includegraphics`. Paths with characters special in
+// text are detokenized, and paths with spaces are braced, as graphicx needs.
+// Report false if the path holds `%`, `#` or braces, which LaTeX cannot load.
+func escapePath(w *bytes.Buffer, path []byte) bool {
+	if bytes.IndexAny(path, "_~^&$ %#{}\\") < 0 {
+		w.Write(path)
+		return true
+	}
+	spaced := bytes.IndexByte(path, ' ') >= 0
+	if spaced {
+		w.WriteByte('{')
+	}
+	w.WriteString(`\detokenize{`)
+	escape(w, path, &pathEscaper)
+	w.WriteByte('}')
+	if spaced {
+		w.WriteByte('}')
+	}
+	return bytes.IndexAny(path, "%#{}") < 0
+}
+
+// Escape the content of a math span: everything is written as is, except a
+// `%` or a `#` that is not escaped, which would comment out the end of the span
+// or be an error.
+func escapeMath(w *bytes.Buffer, text []byte) {
+	org := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '%', '#':
+			w.Write(text[org:i])
+			w.WriteByte('\\')
+			w.WriteByte(text[i])
+			org = i + 1
+		}
+	}
+	w.Write(text[org:])
+}
+
+func (r *Renderer) esc(text []byte) {
+	if r.Flags&Multilingual != 0 && !isASCII(text) {
+		r.multilingual(text)
+		return
+	}
+	r.escText(text)
+}
+
+func (r *Renderer) escText(text []byte) {
+	var w bytes.Buffer
+	escapeText(&w, text, &r.quoted)
+	r.w.Write(r.unicode(w.Bytes()))
+}
+
+func (r *Renderer) escCode(text []byte) {
+	var w bytes.Buffer
+	escapeCode(&w, text)
+	r.w.Write(r.unicode(w.Bytes()))
+}
+
+// Return text escaped for a PDF string, with the characters pdfLaTeX lacks
+// mapped as in the body.
+func (r *Renderer) escPDF(text []byte) []byte {
+	var w bytes.Buffer
+	escapePDF(&w, text)
+	return r.unicode(w.Bytes())
+}
+
+// Return the argument of `\includegraphics` for a file path. The extension is
+// trimmed so that LaTeX loads the most appropriate file.
+func (r *Renderer) graphicsPath(path string) string {
+	path = strings.TrimSuffix(path, filepath.Ext(path))
+	var w bytes.Buffer
+	if !escapePath(&w, []byte(path)) {
+		r.warn("image path %q holds characters LaTeX cannot load", path)
+	}
+	return w.String()
+}
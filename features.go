@@ -0,0 +1,78 @@
+package latex
+
+import (
+	"bytes"
+	"strings"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// Record the constructs of the document that need a package: code, math,
+// images, links, quotes, strikethrough, rules and euro signs.
+func (r *Renderer) usedFeatures(ast *bf.Node, f *Features) {
+	ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if !entering {
+			return bf.GoToNext
+		}
+		switch node.Type {
+		case bf.Code:
+			if bytes.HasPrefix(node.Literal, []byte("$$ ")) {
+				f.Math = true
+			} else {
+				f.Code = true
+			}
+		case bf.CodeBlock:
+			lang, attrs := codeInfo(node.Info)
+			if string(lang) == "math" {
+				f.Math = true
+			} else {
+				f.Code = true
+				f.Quotes = f.Quotes || strings.Contains(attrs.values["caption"], `"`)
+			}
+		case bf.Del:
+			f.Strikethrough = true
+		case bf.HorizontalRule:
+			f.Rules = true
+		case bf.Image:
+			dest := node.LinkData.Destination
+			if hasPrefixCaseInsensitive(dest, []byte("http://")) || hasPrefixCaseInsensitive(dest, []byte("https://")) {
+				f.Links = true
+			} else {
+				f.Images = true
+				f.Quotes = f.Quotes || bytes.IndexByte(node.LinkData.Title, '"') >= 0
+			}
+			return bf.SkipChildren
+		case bf.Link:
+			f.Links = f.Links || node.NoteID == 0
+		case bf.Heading:
+			f.Links = f.Links || !node.IsTitleblock && (needsPDFString(node) || r.phantomSection(node))
+		case bf.Text:
+			text := node.Literal
+			f.Quotes = f.Quotes || bytes.IndexByte(text, '"') >= 0
+			if r.Flags&TeXMath != 0 && (bytes.IndexByte(text, '$') >= 0 || bytes.Contains(text, []byte(`\(`)) || bytes.Contains(text, []byte(`\[`))) {
+				f.Math = true
+			}
+			if r.CrossRefs == CrossRefAutoref && bytes.Contains(text, []byte("[@")) {
+				f.Links = true
+			}
+		}
+		f.Euro = f.Euro || bytes.ContainsRune(node.Literal, '€')
+		return bf.GoToNext
+	})
+}
+
+// Record the constructs of LaTeX already rendered for the preamble or the
+// title page, e.g. the title, the authors or the running headers.
+func headerFeatures(f *Features, texts ...string) {
+	for _, text := range texts {
+		f.Quotes = f.Quotes || strings.Contains(text, `\enquote`)
+		f.Links = f.Links || strings.Contains(text, `\href`) || strings.Contains(text, `\url`) ||
+			strings.Contains(text, `\autoref`) || strings.Contains(text, `\hyperref`) || strings.Contains(text, `\texorpdfstring`)
+		f.Images = f.Images || strings.Contains(text, `\includegraphics`)
+		f.Strikethrough = f.Strikethrough || strings.Contains(text, `\sout`)
+		f.Code = f.Code || strings.Contains(text, `\lstinline`) || strings.Contains(text, `\mintinline`) || strings.Contains(text, `\Verb`)
+		f.Math = f.Math || strings.Contains(text, "$") || strings.Contains(text, `\[`) || strings.Contains(text, `\begin{equation`)
+		f.Rules = f.Rules || strings.Contains(text, `\HRule`)
+		f.Euro = f.Euro || strings.Contains(text, "€")
+	}
+}
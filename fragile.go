@@ -0,0 +1,122 @@
+package latex
+
+import (
+	"bytes"
+	"strconv"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// Contexts in which verbatim constructs such as `\lstinline` do not work,
+// because the content ends up in the argument of a command or in a tabular.
+type fragileContext int
+
+const (
+	inHeading fragileContext = 1 << iota
+	inFootnote
+	inTable
+	inCaption
+)
+
+func (r *Renderer) fragile() bool {
+	return r.context != 0
+}
+
+// Render the children of node in the given context.
+func (r *Renderer) renderChildrenIn(ctx fragileContext, node *bf.Node) []byte {
+	saved := r.context
+	r.context |= ctx
+	result := r.renderChildren(node)
+	r.context = saved
+	return result
+}
+
+// Render a code block robustly: lines are set in `\texttt` and separated by
+// explicit line breaks.
+func (r *Renderer) robustCodeBlock(literal []byte) {
+	lines := bytes.Split(bytes.TrimSuffix(literal, []byte("\n")), []byte("\n"))
+	for i, line := range lines {
+		if i > 0 {
+			r.w.WriteString(`\\` + "\n")
+		}
+		r.w.WriteString(`\texttt{`)
+		for _, field := range bytes.SplitAfter(line, []byte(" ")) {
+			// Keep the indentation and the spacing of the code.
+			if bytes.HasSuffix(field, []byte(" ")) {
+				r.escCode(field[:len(field)-1])
+				r.w.WriteByte('~')
+			} else {
+				r.escCode(field)
+			}
+		}
+		r.w.WriteByte('}')
+	}
+	r.w.WriteString("\n\n")
+}
+
+// Render a footnote. In headings and captions the footnote is protected; in tables only the
+// mark is printed, and the text is saved for after the table.
+func (r *Renderer) footnote(node *bf.Node) {
+	text := r.renderChildrenIn(inFootnote, node.LinkData.Footnote)
+	switch {
+	case r.context&inTable != 0:
+		r.w.WriteString(`\footnotemark{}`)
+		r.tableNotes = append(r.tableNotes, text)
+	case r.context&(inHeading|inCaption) != 0:
+		r.w.WriteString(`\protect\footnote{`)
+		r.w.Write(text)
+		r.w.WriteByte('}')
+	default:
+		r.w.WriteString(`\footnote{`)
+		r.w.Write(text)
+		r.w.WriteByte('}')
+	}
+}
+
+// Print the text of the footnotes marked in a table. The marks have stepped the
+// footnote counter, so it is rewound first.
+func (r *Renderer) tableFootnotes() {
+	if len(r.tableNotes) == 0 {
+		return
+	}
+	r.w.WriteString(`\addtocounter{footnote}{-` + strconv.Itoa(len(r.tableNotes)) + "}\n")
+	for _, text := range r.tableNotes {
+		r.w.WriteString(`\stepcounter{footnote}\footnotetext{`)
+		r.w.Write(text)
+		r.w.WriteString("}\n")
+	}
+	r.tableNotes = nil
+}
+
+// Return true if the heading holds anything else than text, which must then be
+// given a plain version for PDF bookmarks.
+func needsPDFString(heading *bf.Node) bool {
+	for c := heading.FirstChild; c != nil; c = c.Next {
+		if c.Type != bf.Text {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the plain text of a node for PDF strings: text and code only.
+func (r *Renderer) pdfString(node *bf.Node) []byte {
+	saved := r.w
+	r.w = bytes.Buffer{}
+	node.Walk(func(c *bf.Node, entering bool) bf.WalkStatus {
+		switch {
+		case c.Type == bf.Link && c.NoteID != 0:
+			return bf.SkipChildren
+		case c.Type == bf.Text || c.Type == bf.Code:
+			text := c.Literal
+			if c.Next == nil && c.Parent == node {
+				text, _, _ = splitAttributes(text)
+			}
+			r.w.Write(r.escPDF(text))
+		}
+		return bf.GoToNext
+	})
+	result := r.w.Bytes()
+	r.w = saved
+	return result
+}
@@ -0,0 +1,147 @@
+package latex
+
+import (
+	"bytes"
+	"strings"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// The sections shown between the title and the table of contents, rendered to
+// LaTeX.
+type frontMatter struct {
+	abstract       string
+	dedication     string
+	epigraph       string
+	epigraphSource string
+	keywords       []string
+}
+
+// The classes marking a heading whose section belongs to the front matter,
+// e.g. `# Abstract {.abstract}`.
+var frontClasses = []string{"abstract", "dedication", "epigraph", "keywords"}
+
+// Return the front matter of the document, from the metadata or else from the
+// marked sections, and the nodes of these sections, which are left out of the
+// body.
+func (r *Renderer) frontMatter(ast *bf.Node) (frontMatter, map[*bf.Node]bool) {
+	var fm frontMatter
+	nodes := map[*bf.Node]bool{}
+	for node := ast.FirstChild; node != nil; {
+		class, attrs := frontClass(node)
+		if class == "" {
+			node = node.Next
+			continue
+		}
+
+		// The section runs up to the next heading of the same level or above,
+		// or to the next front matter section.
+		heading := node
+		nodes[heading] = true
+		var content []*bf.Node
+		for node = node.Next; node != nil; node = node.Next {
+			if node.Type == bf.Heading && node.Level <= heading.Level {
+				break
+			}
+			if c, _ := frontClass(node); c != "" {
+				break
+			}
+			nodes[node] = true
+			content = append(content, node)
+		}
+
+		switch class {
+		case "abstract":
+			fm.abstract = r.renderNodes(content)
+		case "dedication":
+			fm.dedication = r.renderNodes(content)
+		case "epigraph":
+			fm.epigraph = r.renderNodes(content)
+			fm.epigraphSource = r.escapeMeta(attrs.values["source"])
+		case "keywords":
+			fm.keywords = nil
+			for _, k := range strings.Split(plainText(content), ",") {
+				if k = strings.TrimSpace(k); k != "" {
+					fm.keywords = append(fm.keywords, r.escapeMeta(k))
+				}
+			}
+		}
+	}
+
+	if r.Metadata.Abstract != "" {
+		fm.abstract = r.renderMarkdown(r.Metadata.Abstract)
+	}
+	if r.Metadata.Dedication != "" {
+		fm.dedication = r.renderMarkdown(r.Metadata.Dedication)
+	}
+	if r.Metadata.Epigraph != "" {
+		fm.epigraph = r.renderMarkdown(r.Metadata.Epigraph)
+		fm.epigraphSource = r.escapeMeta(r.Metadata.EpigraphSource)
+	}
+	if len(r.Metadata.Keywords) != 0 {
+		fm.keywords = nil
+		for _, k := range r.Metadata.Keywords {
+			fm.keywords = append(fm.keywords, r.escapeMeta(k))
+		}
+	}
+	return fm, nodes
+}
+
+// Return the front matter class of a heading and its attributes. The class is
+// empty if the node is not a front matter heading.
+func frontClass(node *bf.Node) (string, attributes) {
+	if node.Type != bf.Heading || node.IsTitleblock {
+		return "", attributes{}
+	}
+	attrs := headingAttributes(node)
+	for _, c := range frontClasses {
+		if attrs.hasClass(c) {
+			return c, attrs
+		}
+	}
+	return "", attrs
+}
+
+// Render block nodes in a separate buffer and return the result, trimmed.
+// The nodes are not put in beamer frames, as they end up in the frame of the
+// front matter.
+func (r *Renderer) renderNodes(nodes []*bf.Node) string {
+	saved, frameOpen := r.w, r.frameOpen
+	r.w = bytes.Buffer{}
+	r.frameOpen, r.noFrames = false, true
+	for _, node := range nodes {
+		node.Walk(func(c *bf.Node, entering bool) bf.WalkStatus {
+			return r.RenderNode(&r.w, c, entering)
+		})
+	}
+	result := strings.TrimSpace(r.w.String())
+	r.w, r.frameOpen, r.noFrames = saved, frameOpen, false
+	return result
+}
+
+// Render Markdown text of the metadata.
+func (r *Renderer) renderMarkdown(text string) string {
+	ast := bf.New(bf.WithExtensions(bf.CommonExtensions)).Parse([]byte(text))
+	var nodes []*bf.Node
+	for node := ast.FirstChild; node != nil; node = node.Next {
+		nodes = append(nodes, node)
+	}
+	return r.renderNodes(nodes)
+}
+
+// Return the text of block nodes, paragraphs separated by commas.
+func plainText(nodes []*bf.Node) string {
+	var w bytes.Buffer
+	for _, node := range nodes {
+		node.Walk(func(c *bf.Node, entering bool) bf.WalkStatus {
+			switch {
+			case c.Type == bf.Paragraph && entering:
+				w.WriteByte(',')
+			case c.Type == bf.Text || c.Type == bf.Code:
+				w.Write(c.Literal)
+			}
+			return bf.GoToNext
+		})
+	}
+	return w.String()
+}
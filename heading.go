@@ -0,0 +1,159 @@
+package latex
+
+import (
+	"bytes"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// HeadingMap controls how Markdown headings map to LaTeX sectioning commands.
+//
+// Individual headings can be left unnumbered with the `{-}` or
+// `{.unnumbered}` attribute, e.g. `# Preface {-}`.
+type HeadingMap struct {
+	// Offset is added to the Markdown heading level. With an offset of -1,
+	// `##` headings become the top level, which is handy to embed a README
+	// whose `#` heading is the document title. Levels below 1 are clamped.
+	Offset int
+
+	// Commands overrides the sectioning commands of the document class,
+	// starting from the one used for the top level, e.g.
+	// []string{"chapter", "section"}. Deeper levels are rendered in bold.
+	Commands []string
+
+	// Unnumbered renders all headings with the starred commands. They are
+	// still added to the table of contents.
+	Unnumbered bool
+}
+
+// Return the sectioning command for a Markdown heading level, or the empty
+// string if there is none.
+func (r *Renderer) sectionCommand(level int) string {
+	level += r.Headings.Offset
+	if level < 1 {
+		level = 1
+	}
+	if r.Headings.Commands != nil {
+		if level > len(r.Headings.Commands) {
+			return ""
+		}
+		return r.Headings.Commands[level-1]
+	}
+	return r.class().section(level)
+}
+
+// Render the children of a node in a separate buffer and return the result.
+func (r *Renderer) renderChildren(node *bf.Node) []byte {
+	saved := r.w
+	r.w = bytes.Buffer{}
+	node.Walk(func(c *bf.Node, entering bool) bf.WalkStatus {
+		if c == node {
+			return bf.GoToNext
+		}
+		return r.RenderNode(&r.w, c, entering)
+	})
+	result := r.w.Bytes()
+	r.w = saved
+	return result
+}
+
+// Report whether a heading is unnumbered.
+func (r *Renderer) unnumbered(attrs attributes) bool {
+	return r.Headings.Unnumbered || attrs.unnumbered()
+}
+
+// Report whether a heading gets a hyperref anchor with `\phantomsection`:
+// unnumbered headings, for their entry in the table of contents, and
+// labelled bold headings, which have no anchor of their own.
+func (r *Renderer) phantomSection(node *bf.Node) bool {
+	attrs := headingAttributes(node)
+	switch command := r.sectionCommand(node.Level); {
+	case command == frameCommand:
+		return false
+	case command == "":
+		return attrs.id != ""
+	}
+	return r.unnumbered(attrs)
+}
+
+// Report whether a block of a presentation needs a frame of its own: the
+// content outside frames, e.g. before the first frame heading or right after a
+// section heading, goes in an untitled frame, as beamer would drop it.
+func (r *Renderer) needsFrame(node *bf.Node) bool {
+	if !r.class().beamer || r.frameOpen || r.noFrames || node.Parent == nil || node.Parent.Type != bf.Document {
+		return false
+	}
+	switch node.Type {
+	case bf.HTMLBlock:
+		return false
+	case bf.List:
+		return !node.IsFootnotesList
+	case bf.Heading:
+		return !node.IsTitleblock && r.sectionCommand(node.Level) == ""
+	}
+	return true
+}
+
+func (r *Renderer) heading(node *bf.Node) {
+	attrs := headingAttributes(node)
+	command := r.sectionCommand(node.Level)
+	if r.noFrames && command == frameCommand {
+		command = ""
+	}
+	title := r.renderChildrenIn(inHeading, node)
+	if needsPDFString(node) {
+		title = []byte(`\texorpdfstring{` + string(title) + `}{` + string(r.pdfString(node)) + `}`)
+	}
+
+	if d := headingDivision(attrs); d != "" {
+		r.division(d)
+	}
+
+	if r.frameOpen && command != "" {
+		r.w.WriteString(`\end{frame}` + "\n\n")
+		r.frameOpen = false
+	}
+
+	label := func() {
+		if attrs.id != "" {
+			r.w.WriteString(`\label{` + r.label(attrs.id, headingLabel) + `}`)
+		}
+	}
+	switch {
+	case command == "":
+		if r.phantomSection(node) {
+			r.w.WriteString(`\phantomsection` + "\n")
+		}
+		label()
+		r.w.WriteString(`\textbf{`)
+		r.w.Write(title)
+		r.w.WriteByte('}')
+	case command == frameCommand:
+		// Code listings need fragile frames.
+		r.w.WriteString(`\begin{frame}[fragile]{`)
+		r.w.Write(title)
+		r.w.WriteByte('}')
+		r.frameOpen = true
+	case r.unnumbered(attrs):
+		// The anchor comes after the command, which may start a new page.
+		r.w.WriteString(`\` + command + `*{`)
+		r.w.Write(title)
+		r.w.WriteString("}\n" + `\phantomsection`)
+		label()
+		r.w.WriteString("\n" + `\addcontentsline{toc}{` + command + `}{`)
+		r.w.Write(title)
+		r.w.WriteByte('}')
+	default:
+		r.w.WriteString(`\` + command + `{`)
+		r.w.Write(title)
+		r.w.WriteByte('}')
+		label()
+	}
+
+	// Run-in headings need no newline.
+	if isRunIn(command) {
+		r.w.WriteByte(' ')
+	} else {
+		r.w.WriteByte('\n')
+	}
+}
@@ -0,0 +1,246 @@
+package latex
+
+import (
+	"bytes"
+	"strings"
+)
+
+// A simple lexical description of a programming language, enough to color
+// keywords, comments, strings and numbers.
+type syntax struct {
+	keywords      map[string]bool
+	lineComments  []string
+	blockComments [][2]string
+	quotes        string // Quotes of single-line strings.
+	rawQuotes     string // Quotes of strings that may span several lines.
+}
+
+func keywords(list string) map[string]bool {
+	result := map[string]bool{}
+	for _, k := range strings.Fields(list) {
+		result[k] = true
+	}
+	return result
+}
+
+var cComments = [][2]string{{"/*", "*/"}}
+
+var syntaxes = map[string]*syntax{
+	"c": {
+		keywords: keywords(`auto break case char const continue default do double else enum extern
+			float for goto if inline int long register restrict return short signed sizeof static
+			struct switch typedef union unsigned void volatile while`),
+		lineComments: []string{"//"}, blockComments: cComments, quotes: `"'`,
+	},
+	"cpp": {
+		keywords: keywords(`auto bool break case catch char class const constexpr continue default
+			delete do double else enum explicit extern false float for friend goto if inline int
+			long namespace new noexcept nullptr operator private protected public return short
+			signed sizeof static struct switch template this throw true try typedef typename
+			union unsigned using virtual void volatile while`),
+		lineComments: []string{"//"}, blockComments: cComments, quotes: `"'`,
+	},
+	"go": {
+		keywords: keywords(`break case chan const continue default defer else fallthrough for func
+			go goto if import interface map package range return select struct switch type var
+			nil true false iota`),
+		lineComments: []string{"//"}, blockComments: cComments, quotes: `"'`, rawQuotes: "`",
+	},
+	"java": {
+		keywords: keywords(`abstract boolean break byte case catch char class continue default do
+			double else enum extends final finally float for if implements import instanceof int
+			interface long new null package private protected public return short static super
+			switch this throw throws true false try void while`),
+		lineComments: []string{"//"}, blockComments: cComments, quotes: `"'`,
+	},
+	"javascript": {
+		keywords: keywords(`async await break case catch class const continue default delete do
+			else export extends false finally for function if import in instanceof let new null
+			of return super switch this throw true try typeof undefined var void while yield
+			interface type enum implements private public readonly`),
+		lineComments: []string{"//"}, blockComments: cComments, quotes: `"'`, rawQuotes: "`",
+	},
+	"python": {
+		keywords: keywords(`and as assert async await break class continue def del elif else
+			except False finally for from global if import in is lambda None nonlocal not or
+			pass raise return True try while with yield`),
+		lineComments: []string{"#"}, quotes: `"'`,
+	},
+	"rust": {
+		keywords: keywords(`as async await break const continue crate else enum extern false fn for
+			if impl in let loop match mod move mut pub ref return self Self static struct super
+			trait true type unsafe use where while`),
+		lineComments: []string{"//"}, blockComments: cComments, quotes: `"`,
+	},
+	"shell": {
+		keywords: keywords(`case do done elif else esac export fi for function if in local return
+			then until while`),
+		lineComments: []string{"#"}, quotes: `"'`,
+	},
+	"sql": {
+		keywords: keywords(`ALTER AND AS BY CREATE DELETE DISTINCT DROP FROM GROUP HAVING IN INDEX
+			INSERT INTO IS JOIN LEFT LIMIT NOT NULL ON OR ORDER SELECT SET TABLE UNION UPDATE
+			VALUES WHERE alter and as by create delete distinct drop from group having in index
+			insert into is join left limit not null on or order select set table union update
+			values where`),
+		lineComments: []string{"--"}, blockComments: cComments, quotes: `'"`,
+	},
+	"yaml": {
+		keywords:     keywords(`true false null yes no`),
+		lineComments: []string{"#"}, quotes: `"'`,
+	},
+	"json": {
+		keywords: keywords(`true false null`),
+		quotes:   `"`,
+	},
+}
+
+var syntaxAliases = map[string]string{
+	"bash":       "shell",
+	"c++":        "cpp",
+	"golang":     "go",
+	"js":         "javascript",
+	"kotlin":     "java",
+	"py":         "python",
+	"rs":         "rust",
+	"sh":         "shell",
+	"ts":         "javascript",
+	"typescript": "javascript",
+	"yml":        "yaml",
+	"zsh":        "shell",
+}
+
+func findSyntax(lang string) *syntax {
+	lang = strings.ToLower(lang)
+	if alias, ok := syntaxAliases[lang]; ok {
+		lang = alias
+	}
+	return syntaxes[lang]
+}
+
+// Escape the characters that fancyvrb's `commandchars` makes special.
+func writeVerbatim(w *bytes.Buffer, text string) {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			w.WriteString(`\char92{}`)
+		case '{':
+			w.WriteString(`\char123{}`)
+		case '}':
+			w.WriteString(`\char125{}`)
+		default:
+			w.WriteByte(text[i])
+		}
+	}
+}
+
+// Write a token with a style. Verbatim environments are processed line by
+// line, so the style is applied to each line separately.
+func writeToken(w *bytes.Buffer, style, text string) {
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			w.WriteByte('\n')
+		}
+		if line == "" {
+			continue
+		}
+		w.WriteString(style)
+		writeVerbatim(w, line)
+		w.WriteString(strings.Repeat("}", strings.Count(style, "{")-strings.Count(style, "}")))
+	}
+}
+
+const (
+	keywordStyle = `\textcolor{CodeKeyword}{\textbf{`
+	commentStyle = `\textcolor{CodeComment}{\textit{`
+	stringStyle  = `\textcolor{CodeString}{`
+	numberStyle  = `\textcolor{CodeNumber}{`
+)
+
+func isIdentifier(c byte) bool {
+	return isalnum(c) || c == '_' || c >= 0x80
+}
+
+// Return the length of the string starting at the beginning of text.
+func stringLength(text string, multiline bool) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && !multiline:
+			i++
+		case text[i] == quote:
+			return i + 1
+		case text[i] == '\n' && !multiline:
+			return i
+		}
+	}
+	return len(text)
+}
+
+// Write code in the commandchars syntax of fancyvrb, with keywords, comments,
+// strings and numbers colored. Code in an unknown language is written as is.
+func highlight(w *bytes.Buffer, lang string, code []byte) {
+	s := findSyntax(lang)
+	text := string(code)
+	if s == nil {
+		writeVerbatim(w, text)
+		return
+	}
+
+	org := 0
+	flush := func(i int) {
+		writeVerbatim(w, text[org:i])
+	}
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		style, n := "", 0
+
+		for _, c := range s.lineComments {
+			if n == 0 && strings.HasPrefix(rest, c) {
+				style, n = commentStyle, strings.IndexByte(rest, '\n')
+				if n < 0 {
+					n = len(rest)
+				}
+			}
+		}
+		for _, c := range s.blockComments {
+			if n == 0 && strings.HasPrefix(rest, c[0]) {
+				style, n = commentStyle, strings.Index(rest[len(c[0]):], c[1])
+				if n < 0 {
+					n = len(rest)
+				} else {
+					n += len(c[0]) + len(c[1])
+				}
+			}
+		}
+		switch {
+		case n > 0:
+		case strings.IndexByte(s.quotes, rest[0]) >= 0:
+			style, n = stringStyle, stringLength(rest, false)
+		case strings.IndexByte(s.rawQuotes, rest[0]) >= 0:
+			style, n = stringStyle, stringLength(rest, true)
+		case isIdentifier(rest[0]) && (i == 0 || !isIdentifier(text[i-1])):
+			for n < len(rest) && (isIdentifier(rest[n]) || rest[n] == '.' && isDigit(rest[0])) {
+				n++
+			}
+			if isDigit(rest[0]) {
+				style = numberStyle
+			} else if s.keywords[rest[:n]] {
+				style = keywordStyle
+			}
+		}
+
+		if style == "" {
+			if n == 0 {
+				n = 1
+			}
+			i += n
+			continue
+		}
+		flush(i)
+		writeToken(w, style, rest[:n])
+		i += n
+		org = i
+	}
+	flush(len(text))
+}
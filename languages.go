@@ -0,0 +1,196 @@
+package latex
+
+import (
+	"sort"
+	"strings"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// Listings names of the languages of code blocks, indexed by lower-case name
+// or alias.
+var listingsLanguages = map[string]string{
+	"ada":        "Ada",
+	"awk":        "Awk",
+	"bash":       "bash",
+	"c":          "C",
+	"c++":        "C++",
+	"cobol":      "Cobol",
+	"cpp":        "C++",
+	"cs":         "[Sharp]C",
+	"csh":        "csh",
+	"csharp":     "[Sharp]C",
+	"cxx":        "C++",
+	"delphi":     "Delphi",
+	"docker":     "Dockerfile",
+	"dockerfile": "Dockerfile",
+	"erlang":     "erlang",
+	"fortran":    "Fortran",
+	"gnuplot":    "Gnuplot",
+	"go":         "Go",
+	"golang":     "Go",
+	"haskell":    "Haskell",
+	"hs":         "Haskell",
+	"html":       "HTML",
+	"java":       "Java",
+	"javascript": "JavaScript",
+	"js":         "JavaScript",
+	"json":       "JSON",
+	"kotlin":     "Kotlin",
+	"ksh":        "ksh",
+	"kt":         "Kotlin",
+	"latex":      "TeX",
+	"lisp":       "Lisp",
+	"lua":        "Lua",
+	"make":       "make",
+	"makefile":   "make",
+	"matlab":     "Matlab",
+	"ocaml":      "Caml",
+	"octave":     "Octave",
+	"pascal":     "Pascal",
+	"perl":       "Perl",
+	"php":        "PHP",
+	"pl":         "Perl",
+	"prolog":     "Prolog",
+	"py":         "Python",
+	"python":     "Python",
+	"python3":    "Python",
+	"r":          "R",
+	"rb":         "Ruby",
+	"rs":         "Rust",
+	"ruby":       "Ruby",
+	"rust":       "Rust",
+	"sh":         "sh",
+	"shell":      "bash",
+	"sql":        "SQL",
+	"tcl":        "tcl",
+	"tex":        "TeX",
+	"ts":         "TypeScript",
+	"typescript": "TypeScript",
+	"verilog":    "Verilog",
+	"vhdl":       "VHDL",
+	"xml":        "XML",
+	"yaml":       "YAML",
+	"yml":        "YAML",
+	"zsh":        "bash",
+}
+
+// Definitions of the languages listings does not know.
+var listingsDefinitions = map[string]string{
+	"Go": `\lstdefinelanguage{Go}{
+	morekeywords={break,case,chan,const,continue,default,defer,else,fallthrough,
+		for,func,go,goto,if,import,interface,map,package,range,return,select,struct,
+		switch,type,var,nil,true,false,iota},
+	sensitive=true,
+	morecomment=[l]{//},
+	morecomment=[s]{/*}{*/},
+	morestring=[b]",
+	morestring=[b]',
+	morestring=[s]{` + "`" + `}{` + "`" + `},
+}`,
+	"Rust": `\lstdefinelanguage{Rust}{
+	morekeywords={as,async,await,break,const,continue,crate,else,enum,extern,false,
+		fn,for,if,impl,in,let,loop,match,mod,move,mut,pub,ref,return,self,Self,static,
+		struct,super,trait,true,type,unsafe,use,where,while},
+	sensitive=true,
+	morecomment=[l]{//},
+	morecomment=[s]{/*}{*/},
+	morestring=[b]",
+}`,
+	"JavaScript": `\lstdefinelanguage{JavaScript}{
+	morekeywords={async,await,break,case,catch,class,const,continue,default,delete,
+		do,else,export,extends,false,finally,for,function,if,import,in,instanceof,let,
+		new,null,of,return,super,switch,this,throw,true,try,typeof,undefined,var,void,
+		while,yield},
+	sensitive=true,
+	morecomment=[l]{//},
+	morecomment=[s]{/*}{*/},
+	morestring=[b]",
+	morestring=[b]',
+	morestring=[s]{` + "`" + `}{` + "`" + `},
+}`,
+	"TypeScript": `\lstdefinelanguage{TypeScript}[]{JavaScript}{
+	morekeywords={interface,type,enum,implements,private,public,protected,readonly,
+		namespace,declare,abstract,as,keyof},
+}`,
+	"Kotlin": `\lstdefinelanguage{Kotlin}{
+	morekeywords={as,break,class,continue,do,else,false,for,fun,if,in,interface,is,
+		null,object,package,return,super,this,throw,true,try,typealias,val,var,when,
+		while,import,private,public,internal,override,data},
+	sensitive=true,
+	morecomment=[l]{//},
+	morecomment=[s]{/*}{*/},
+	morestring=[b]",
+	morestring=[b]',
+}`,
+	"YAML": `\lstdefinelanguage{YAML}{
+	morekeywords={true,false,null,yes,no},
+	sensitive=false,
+	morecomment=[l]{\#},
+	morestring=[b]",
+	morestring=[b]',
+}`,
+	"JSON": `\lstdefinelanguage{JSON}{
+	morekeywords={true,false,null},
+	sensitive=true,
+	morestring=[b]",
+}`,
+	"Dockerfile": `\lstdefinelanguage{Dockerfile}{
+	morekeywords={FROM,RUN,CMD,LABEL,EXPOSE,ENV,ADD,COPY,ENTRYPOINT,VOLUME,USER,
+		WORKDIR,ARG,ONBUILD,STOPSIGNAL,HEALTHCHECK,SHELL,AS},
+	sensitive=false,
+	morecomment=[l]{\#},
+	morestring=[b]",
+}`,
+}
+
+// Languages whose definition is based on another one.
+var listingsParents = map[string]string{
+	"TypeScript": "JavaScript",
+}
+
+// Return the listings name of a code block language, or the empty string if
+// listings does not know it.
+func listingsLanguage(lang string) string {
+	return listingsLanguages[strings.ToLower(lang)]
+}
+
+// Return the definitions of the languages listings lacks for the code blocks
+// of the document, in a stable order.
+func listingsLanguageDefinitions(ast *bf.Node) []string {
+	needed := map[string]bool{}
+	ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if node.Type == bf.CodeBlock {
+			lang, _ := codeInfo(node.Info)
+			if name := listingsLanguage(string(lang)); listingsDefinitions[name] != "" {
+				needed[name] = true
+			}
+		}
+		return bf.GoToNext
+	})
+
+	var names []string
+	for name := range needed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var definitions []string
+	defined := map[string]bool{}
+	var define func(name string)
+	define = func(name string) {
+		if defined[name] {
+			return
+		}
+		defined[name] = true
+		// Parents must be defined first.
+		if parent := listingsParents[name]; parent != "" {
+			define(parent)
+		}
+		definitions = append(definitions, listingsDefinitions[name])
+	}
+	for _, name := range names {
+		define(name)
+	}
+	return definitions
+}
@@ -6,9 +6,11 @@ package latex
 
 import (
 	"bytes"
+	"fmt"
 	"io"
-	"path/filepath"
+	"net/url"
 	"strings"
+	"text/template"
 
 	bf "github.com/russross/blackfriday/v2"
 )
@@ -22,16 +24,123 @@ type Renderer struct {
 	Flags Flag
 
 	// The document author displayed by the `\maketitle` command.
-	// This will only display if the `Titleblock` extension is on and a title is
-	// present.
+	// This will only display if a title is present. It overrides the metadata
+	// and the title block.
 	Author string
 
+	// The document authors, with their affiliations, emails and ORCIDs. They
+	// override Author, the metadata and the title block.
+	Authors []Author
+
+	// The document title and date. They override the metadata and the title
+	// block.
+	Title string
+	Date  string
+
 	// The languages to be used by the `babel` package.
 	// Languages must be comma-spearated.
 	Languages string
 
+	// The document class. It also decides how heading levels map to sectioning
+	// commands.
+	DocumentClass DocumentClass
+
+	// How headings map to sectioning commands.
+	Headings HeadingMap
+
+	// The running headers and footers.
+	PageStyle PageStyle
+
+	// The watermark and marks of a draft.
+	Draft Draft
+
+	// The look of the document. It is nil for the theme named by the
+	// metadata, or else DefaultTheme.
+	Theme *Theme
+
+	// The page layout. It overrides the layout of the metadata, field by
+	// field.
+	Layout Layout
+
+	// Packages, macros and raw LaTeX added to the preamble and to the
+	// document, after those of the metadata.
+	Preamble Preamble
+
+	// The deepest Markdown heading levels listed in the table of contents
+	// and numbered. Zero keeps the defaults of the document class.
+	TOCDepth    int
+	SecNumDepth int
+
+	// How code is typeset.
+	CodeEngine CodeEngine
+
+	// How links to headings of the document are rendered.
+	CrossRefs CrossRefStyle
+
+	// The document metadata, usually parsed from the front matter with
+	// ParseFrontMatter. The renderer fields, when set, take precedence.
+	Metadata Metadata
+
+	// The TeX engine the document is compiled with.
+	Engine Engine
+
+	// The main, sans-serif and monospaced fonts, by their system name, e.g.
+	// "Noto Serif". They are only used with XeLaTeX and LuaLaTeX; empty
+	// means the engine default.
+	MainFont string
+	SansFont string
+	MonoFont string
+
+	// The fonts of CJK, Hebrew and Arabic text with the Multilingual flag,
+	// for XeLaTeX and LuaLaTeX.
+	CJKFont    string
+	HebrewFont string
+	ArabicFont string
+
+	// What replaces the characters pdfLaTeX cannot typeset, raw LaTeX such as
+	// `\textbf{?}`. The characters are dropped when empty. Either way, a
+	// warning is reported.
+	UnicodePlaceholder string
+
+	// Templates used to render the preamble, the title and the footer.
+	// Defaults to DefaultTemplates() when nil.
+	Templates *template.Template
+
 	// If text is within quotes.
 	quoted bool
+
+	// If a beamer frame is waiting to be closed.
+	frameOpen bool
+
+	// If blocks are rendered outside the body, e.g. the front matter, where
+	// they are not put in frames.
+	noFrames bool
+
+	// Labels of the document, indexed by identifier.
+	labels map[string]label
+
+	// The fragile contexts the current node is in.
+	context fragileContext
+
+	// Characters already reported as unsupported.
+	unmapped map[rune]bool
+
+	// If right-to-left text has been reported as unsupported.
+	rtlWarned bool
+
+	// Text of the footnotes of the current table.
+	tableNotes [][]byte
+
+	// If the appendix has started, and if it is a group to be closed at the
+	// end of the chapter.
+	appendix      bool
+	appendixGroup bool
+
+	// Nodes of the front matter sections, rendered in the header.
+	skipped map[*bf.Node]bool
+
+	// Problems found while rendering.
+	warnings []string
 }
 
 // Flag controls the options of the renderer.
@@ -43,8 +152,9 @@ const (
 	// CompletePage generates a complete LaTeX document, preamble included.
 	CompletePage Flag = 1 << iota
 
-	// ChapterTitle uses the titleblock (if the extension is on) as chapter title.
-	// Ignored when CompletePage is on.
+	// ChapterTitle uses the titleblock (if the extension is on) as chapter title,
+	// or as the sectioning level above level 1 headings when DocumentClass is
+	// set. Ignored when CompletePage is on.
 	ChapterTitle
 
 	// No paragraph indentation.
@@ -54,6 +164,25 @@ const (
 	Safelink  // Only link to trusted protocols.
 
 	TOC // Generate the table of content.
+
+	// TeXMath renders TeX math found in text: `$...$` and `\(...\)` inline,
+	// `$$...$$` and `\[...\]` for display. Markdown eats single backslashes
+	// before punctuation, so the latter forms are written `\\(x\\)` in the
+	// input.
+	TeXMath
+
+	// Multilingual wraps runs of CJK, Hebrew and Arabic text in the commands
+	// the engine needs, and loads the matching packages.
+	Multilingual
+
+	// MinimalPreamble only loads the packages of the constructs the document
+	// uses, e.g. listings when it has code or ulem when it has strikethrough
+	// text. Packages needed by raw LaTeX must be added to the preamble.
+	MinimalPreamble
+
+	// TableCaptions renders the paragraph that follows a table and starts with
+	// "Table:" or ":" as the caption of the table, as in Pandoc.
+	TableCaptions
 )
 
 var cellAlignment = [4]byte{
@@ -63,59 +192,44 @@ var cellAlignment = [4]byte{
 	bf.TableAlignmentCenter: 'c',
 }
 
-var latexEscaper = [256][]byte{
-	'#':  []byte(`\#`),
-	'$':  []byte(`\$`),
-	'%':  []byte(`\%`),
-	'&':  []byte(`\&`),
-	'\\': []byte(`\textbackslash{}`),
-	'_':  []byte(`\_`),
-	'{':  []byte(`\{`),
-	'}':  []byte(`\}`),
-	'~':  []byte(`\~`),
-	'"':  []byte(`\enquote{`),
-}
-
-func (r *Renderer) esc(text []byte) {
-	for i := 0; i < len(text); i++ {
-		// directly copy normal characters
-		org := i
-
-		for i < len(text) && latexEscaper[text[i]] == nil {
-			i++
-		}
-
-		if i > org {
-			r.w.Write(text[org:i])
-			if i >= len(text) {
-				break
-			}
-		}
-
-		// escape a character
-		if text[i] == '"' {
-			if r.quoted {
-				r.w.WriteByte('}')
-				r.quoted = false
-			} else {
-				r.w.Write(latexEscaper[text[i]])
-				r.quoted = true
-			}
-		} else {
-			r.w.Write(latexEscaper[text[i]])
-		}
+// Return the literal of the run of consecutive Text nodes starting at node,
+// and the last node of the run. Blackfriday splits text on characters with a
+// Markdown meaning, so math spans and references may be scattered over several
+// nodes.
+func textRun(node *bf.Node) ([]byte, *bf.Node) {
+	if node.Next == nil || node.Next.Type != bf.Text {
+		return node.Literal, node
+	}
+	var run []byte
+	last := node
+	for n := node; n != nil && n.Type == bf.Text; n = n.Next {
+		run = append(run, n.Literal...)
+		last = n
 	}
+	return run, last
 }
 
-func languageAttr(info []byte) []byte {
+// Split a code block info string into the language and the attributes, e.g.
+// "go {#lst:main}", or ".go #lst:main" when Blackfriday stripped the braces.
+func codeInfo(info []byte) ([]byte, attributes) {
 	if len(info) == 0 {
-		return nil
+		return nil, attributes{}
+	}
+	if info[0] == '.' || info[0] == '#' {
+		attrs := parseAttributes(string(info))
+		if len(attrs.classes) == 0 {
+			return nil, attrs
+		}
+		lang := []byte(attrs.classes[0])
+		attrs.classes = attrs.classes[1:]
+		return lang, attrs
 	}
 	endOfLang := bytes.IndexAny(info, "\t ")
 	if endOfLang < 0 {
-		return info
+		return info, attributes{}
 	}
-	return info[:endOfLang]
+	_, attrs, _ := splitAttributes(info[endOfLang:])
+	return info[:endOfLang], attrs
 }
 
 func (r *Renderer) env(environment string, entering bool) {
@@ -173,6 +287,15 @@ func hasPrefixCaseInsensitive(s, prefix []byte) bool {
 // As a rule of thumb to enforce consistency, each node is responsible for
 // appending the needed line breaks. Line breaks are never prepended.
 func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.WalkStatus {
+	if r.skipped[node] {
+		// Front matter sections are in the header.
+		return bf.SkipChildren
+	}
+	if entering && r.needsFrame(node) {
+		r.w.WriteString(`\begin{frame}[fragile]` + "\n")
+		r.frameOpen = true
+	}
+
 	switch node.Type {
 
 	case bf.BlockQuote:
@@ -187,31 +310,15 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 			r.w.WriteByte('$')
 			break
 		}
-		// 'lstinline' needs an ASCII delimiter that is not in the node content.
-		// TODO: Find a more elegant fallback for when the code lists all ASCII characters.
-		delimiter := getDelimiter(node.Literal)
-		r.w.WriteString(`\lstinline`)
-		if delimiter != 0 {
-			r.w.WriteByte(delimiter)
-			r.w.Write(node.Literal)
-			r.w.WriteByte(delimiter)
-		} else {
-			r.w.WriteString("!<RENDERING ERROR: no delimiter found>!")
-		}
+		r.code(node.Literal)
 
 	case bf.CodeBlock:
-		lang := languageAttr(node.Info)
+		lang, attrs := codeInfo(node.Info)
 		if bytes.Compare(lang, []byte("math")) == 0 {
-			r.w.WriteString("\\[\n")
-			r.w.Write(node.Literal)
-			r.w.WriteString("\\]\n\n")
+			r.mathBlock(node.Literal, attrs)
 			break
 		}
-		r.w.WriteString(`\begin{lstlisting}[language=`)
-		r.w.Write(lang)
-		r.w.WriteString("]\n")
-		r.w.Write(node.Literal)
-		r.w.WriteString(`\end{lstlisting}` + "\n\n")
+		r.codeBlock(lang, node.Literal, attrs)
 
 	case bf.Del:
 		r.cmd("sout", entering)
@@ -231,34 +338,15 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 			break
 		}
 		if entering {
-			switch node.Level {
-			case 1:
-				r.w.WriteString(`\section{`)
-			case 2:
-				r.w.WriteString(`\subsection{`)
-			case 3:
-				r.w.WriteString(`\subsubsection{`)
-			case 4:
-				r.w.WriteString(`\paragraph{`)
-			case 5:
-				r.w.WriteString(`\subparagraph{`)
-			case 6:
-				r.w.WriteString(`\textbf{`)
-			}
-		} else {
-			r.w.WriteByte('}')
-			switch node.Level {
-			// Paragraph need no newline.
-			case 1, 2, 3:
-				r.w.WriteByte('\n')
-			default:
-				r.w.WriteByte(' ')
-			}
+			r.heading(node)
 		}
+		return bf.SkipChildren
 
 	case bf.HTMLBlock:
-		// HTML code makes no sense in LaTeX.
-		break
+		// HTML code makes no sense in LaTeX, except for division comments.
+		if d := commentDivision(node.Literal); d != "" {
+			r.division(d)
+		}
 
 	case bf.HTMLSpan:
 		// HTML code makes no sense in LaTeX.
@@ -272,7 +360,19 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 			dest := node.LinkData.Destination
 			if hasPrefixCaseInsensitive(dest, []byte("http://")) || hasPrefixCaseInsensitive(dest, []byte("https://")) {
 				r.w.WriteString(`\url{`)
-				r.w.Write(dest)
+				escapeURL(&r.w, dest)
+				r.w.WriteByte('}')
+				return bf.SkipChildren
+			}
+			// Local paths are percent-decoded, as in Pandoc.
+			path := string(dest)
+			if p, err := url.PathUnescape(path); err == nil {
+				path = p
+			}
+			if r.fragile() {
+				// No floats nor environments in arguments and tables.
+				r.w.WriteString(`\includegraphics[max width=\linewidth, max height=\baselineskip]{`)
+				r.w.WriteString(r.graphicsPath(path))
 				r.w.WriteByte('}')
 				return bf.SkipChildren
 			}
@@ -280,15 +380,14 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 				r.w.WriteString(`\begin{figure}[!ht]` + "\n")
 			}
 			r.w.WriteString(`\begin{center}` + "\n")
-			// Trim extension so that LaTeX loads the most appropriate file.
-			ext := filepath.Ext(string(dest))
-			dest = dest[:len(dest)-len(ext)]
 			r.w.WriteString(`\includegraphics[max width=\textwidth, max height=\textheight]{`)
-			r.w.Write(dest)
+			r.w.WriteString(r.graphicsPath(path))
 			r.w.WriteString("}\n" + `\end{center}` + "\n")
 			if node.LinkData.Title != nil {
 				r.w.WriteString(`\caption{`)
-				r.w.Write(node.LinkData.Title)
+				var caption bytes.Buffer
+				escapeCaption(&caption, node.LinkData.Title)
+				r.w.Write(r.unicode(caption.Bytes()))
 				r.w.WriteString("}\n" + `\end{figure}` + "\n")
 			}
 		}
@@ -311,12 +410,20 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 		// TODO: Relative links do not make sense in LaTeX. Print a warning?
 		dest := node.LinkData.Destination
 
+		// Cross reference
+		if isFragment(dest) && node.NoteID == 0 && r.Flags&SkipLinks == 0 {
+			if entering {
+				r.crossRef(node)
+			}
+			return bf.SkipChildren
+		}
+
 		// Raw URI
 		if needSkipLink(r.Flags, dest) {
 			if node.FirstChild != node.LastChild || node.FirstChild.Type != bf.Text || bytes.Compare(dest, node.FirstChild.Literal) != 0 {
 				if !entering {
 					r.w.WriteString(`\footnote{\nolinkurl{`)
-					r.w.Write(dest)
+					escapeURL(&r.w, dest)
 					r.w.WriteString(`}}`)
 				}
 				break
@@ -324,7 +431,7 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 			// Link content (only one Text child) and destination are identical (e.g.
 			// with autolink).
 			r.w.WriteString(`\nolinkurl{`)
-			r.w.Write(dest)
+			escapeURL(&r.w, dest)
 			r.w.WriteByte('}')
 			return bf.SkipChildren
 		}
@@ -332,17 +439,7 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 		// Footnotes
 		if node.NoteID != 0 {
 			if entering {
-				r.w.WriteString(`\footnote{`)
-				w := bytes.Buffer{}
-				footnoteNode := node.LinkData.Footnote
-				footnoteNode.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
-					if node == footnoteNode {
-						return bf.GoToNext
-					}
-					return r.RenderNode(&w, node, entering)
-				})
-				r.w.Write(w.Bytes())
-				r.w.WriteString(`}`)
+				r.footnote(node)
 			}
 			break
 		}
@@ -350,7 +447,7 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 		// Normal link
 		if entering {
 			r.w.WriteString(`\href{`)
-			r.w.Write(dest)
+			escapeURL(&r.w, dest)
 			r.w.WriteString(`}{`)
 		} else {
 			r.w.WriteByte('}')
@@ -372,6 +469,10 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 		r.env(listType, entering)
 
 	case bf.Paragraph:
+		if r.isTableCaption(node) {
+			// Rendered with the table.
+			return bf.SkipChildren
+		}
 		if !entering {
 			// If paragraph is the term of a definition list, don't insert new lines.
 			if node.Parent.Type != bf.Item || node.Parent.ListFlags&bf.ListTypeTerm == 0 {
@@ -393,7 +494,15 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 
 	case bf.Table:
 		if entering {
-			r.w.WriteString(`\begin{center}` + "\n" + `\begin{tabular}{`)
+			if caption := r.captionParagraph(node); caption != nil {
+				r.w.WriteString(`\begin{table}[htbp]` + "\n" + `\centering` + "\n" + `\caption{`)
+				r.w.Write(r.tableCaption(caption))
+				r.w.WriteString("}\n")
+			} else {
+				r.w.WriteString(`\begin{center}` + "\n")
+			}
+			r.context |= inTable
+			r.w.WriteString(`\begin{tabular}{`)
 			node.Walk(func(c *bf.Node, entering bool) bf.WalkStatus {
 				if c.Type == bf.TableCell && entering {
 					for cell := c; cell != nil; cell = cell.Next {
@@ -405,7 +514,14 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 			})
 			r.w.WriteString("}\n")
 		} else {
-			r.w.WriteString(`\end{tabular}` + "\n" + `\end{center}` + "\n\n")
+			r.context &^= inTable
+			r.w.WriteString(`\end{tabular}` + "\n")
+			r.tableFootnotes()
+			if r.captionParagraph(node) != nil {
+				r.w.WriteString(`\end{table}` + "\n\n")
+			} else {
+				r.w.WriteString(`\end{center}` + "\n\n")
+			}
 		}
 
 	case bf.TableBody:
@@ -431,8 +547,16 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 		}
 
 	case bf.Text:
-		r.esc(node.Literal)
-		break
+		if node.Prev != nil && node.Prev.Type == bf.Text {
+			// Already rendered with the first node of the run.
+			break
+		}
+		text, last := textRun(node)
+		if last.Next == nil && node.Parent != nil && node.Parent.Type == bf.Heading {
+			// Drop the heading attributes.
+			text, _, _ = splitAttributes(text)
+		}
+		r.text(text)
 
 	default:
 		panic("Unknown node type " + node.Type.String())
@@ -440,20 +564,84 @@ func (r *Renderer) RenderNode(w io.Writer, node *bf.Node, entering bool) bf.Walk
 	return bf.GoToNext
 }
 
-// Get title: concatenate all Text children of Titleblock.
-func getTitle(ast *bf.Node) []byte {
-	titleRenderer := Renderer{}
+// The parts of a Pandoc-style title block, rendered to LaTeX:
+//
+//	% Title
+//	% Author; Author
+//	% Date
+type titleBlock struct {
+	title   []byte
+	authors [][]byte
+	date    []byte
+
+	// The author names for the PDF metadata.
+	pdfAuthors []string
+}
 
+// Return a renderer of inline text outside of the body, such as titles, with
+// the inline rules of the body.
+func (r *Renderer) inlineRenderer() *Renderer {
+	return &Renderer{
+		Flags:              r.Flags & (TeXMath | Multilingual),
+		context:            inHeading,
+		Engine:             r.Engine,
+		UnicodePlaceholder: r.UnicodePlaceholder,
+		unmapped:           r.unmapped,
+	}
+}
+
+// Parse the title block of the document. Each of its lines is one part; an
+// empty line, "%" alone, leaves a part out.
+func (r *Renderer) titleBlock(ast *bf.Node) titleBlock {
+	// The parts are arguments of `\title`, `\author` and `\date`.
+	titleRenderer := r.inlineRenderer()
+
+	var plain bytes.Buffer
 	ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
 		if node.Type == bf.Heading && node.HeadingData.IsTitleblock && entering {
 			node.Walk(func(c *bf.Node, entering bool) bf.WalkStatus {
+				if c.Type == bf.Text || c.Type == bf.Code {
+					plain.Write(c.Literal)
+				}
 				return titleRenderer.RenderNode(&titleRenderer.w, c, entering)
 			})
 			return bf.Terminate
 		}
 		return bf.GoToNext
 	})
-	return titleRenderer.w.Bytes()
+	if titleRenderer.quoted {
+		titleRenderer.w.WriteByte('}')
+	}
+	r.warnings = append(r.warnings, titleRenderer.warnings...)
+
+	var tb titleBlock
+	for i, line := range bytes.SplitN(titleRenderer.w.Bytes(), []byte("\n"), 3) {
+		line = bytes.TrimSpace(line)
+		if bytes.Equal(line, []byte(`\%`)) {
+			continue
+		}
+		switch i {
+		case 0:
+			tb.title = line
+		case 1:
+			for _, author := range bytes.Split(line, []byte(";")) {
+				if author = bytes.TrimSpace(author); len(author) != 0 {
+					tb.authors = append(tb.authors, author)
+				}
+			}
+		case 2:
+			// Pandoc allows the date to span several lines.
+			tb.date = bytes.Join(bytes.Fields(line), []byte(" "))
+		}
+	}
+	if lines := bytes.SplitN(plain.Bytes(), []byte("\n"), 3); len(lines) > 1 {
+		for _, author := range bytes.Split(lines[1], []byte(";")) {
+			if author = bytes.TrimSpace(author); len(author) != 0 && string(author) != "%" {
+				tb.pdfAuthors = append(tb.pdfAuthors, string(r.escPDF(author)))
+			}
+		}
+	}
+	return tb
 }
 
 func hasFigures(ast *bf.Node) bool {
@@ -470,137 +658,62 @@ func hasFigures(ast *bf.Node) bool {
 
 // RenderHeader prints the LaTeX preamble if CompletePage is on.
 func (r *Renderer) RenderHeader(w io.Writer, ast *bf.Node) {
-	var title string
-
-	if r.Flags&CompletePage != 0 {
-		title = string(getTitle(ast))
-
-		// TODO: Color source code and links?
-		io.WriteString(w, `\documentclass{article}
-
-\usepackage[utf8]{inputenc}
-\usepackage[T1]{fontenc}
-\usepackage{lmodern}
-\usepackage{marvosym}
-\usepackage{textcomp}
-\DeclareUnicodeCharacter{20AC}{\EUR{}}
-\DeclareUnicodeCharacter{2260}{\neq}
-\DeclareUnicodeCharacter{2264}{\leq}
-\DeclareUnicodeCharacter{2265}{\geq}
-\DeclareUnicodeCharacter{22C5}{\cdot}
-\DeclareUnicodeCharacter{A0}{~}
-\DeclareUnicodeCharacter{B1}{\pm}
-\DeclareUnicodeCharacter{D7}{\times}
-
-\usepackage{amsmath}
-\usepackage[export]{adjustbox} % loads also graphicx
-\usepackage{listings}
-\usepackage[margin=1in]{geometry}
-\usepackage{verbatim}
-\usepackage[normalem]{ulem}
-\usepackage{hyperref}
-
-\lstset{
-	numbers=left,
-	breaklines=true,
-	xleftmargin=2\baselineskip,
-	showstringspaces=false,
-	basicstyle=\ttfamily,
-	keywordstyle=\bfseries\color{green!40!black},
-	commentstyle=\itshape\color{purple!40!black},
-	stringstyle=\color{orange},
-	numberstyle=\ttfamily,
-	literate=
-	{á}{{\'a}}1 {é}{{\'e}}1 {í}{{\'i}}1 {ó}{{\'o}}1 {ú}{{\'u}}1
-	{Á}{{\'A}}1 {É}{{\'E}}1 {Í}{{\'I}}1 {Ó}{{\'O}}1 {Ú}{{\'U}}1
-	`)
-		io.WriteString(w,
-			"{à}{{\\`a}}1 {è}{{\\`e}}1 {ì}{{\\`i}}1 {ò}{{\\`o}}1 {ù}{{\\`u}}1"+
-				"\n\t"+
-				"{À}{{\\`A}}1 {È}{{\\'E}}1 {Ì}{{\\`I}}1 {Ò}{{\\`O}}1 {Ù}{{\\`U}}1")
-		io.WriteString(w, `
-	{ä}{{\"a}}1 {ë}{{\"e}}1 {ï}{{\"i}}1 {ö}{{\"o}}1 {ü}{{\"u}}1
-	{Ä}{{\"A}}1 {Ë}{{\"E}}1 {Ï}{{\"I}}1 {Ö}{{\"O}}1 {Ü}{{\"U}}1
-	{â}{{\^a}}1 {ê}{{\^e}}1 {î}{{\^i}}1 {ô}{{\^o}}1 {û}{{\^u}}1
-	{Â}{{\^A}}1 {Ê}{{\^E}}1 {Î}{{\^I}}1 {Ô}{{\^O}}1 {Û}{{\^U}}1
-	{œ}{{\oe}}1 {Œ}{{\OE}}1 {æ}{{\ae}}1 {Æ}{{\AE}}1 {ß}{{\ss}}1
-	{ű}{{\H{u}}}1 {Ű}{{\H{U}}}1 {ő}{{\H{o}}}1 {Ő}{{\H{O}}}1
-	{ç}{{\c c}}1 {Ç}{{\c C}}1 {ø}{{\o}}1 {å}{{\r a}}1 {Å}{{\r A}}1
-	{€}{{\EUR}}1 {£}{{\pounds}}1
-}
-`)
-
-		if r.Languages != "" {
-			io.WriteString(w, "\n"+`\usepackage[`+r.Languages+`]{babel}`+"\n")
-		}
-
-		io.WriteString(w, `\usepackage{csquotes}
-
-\hypersetup{colorlinks,
-	citecolor=black,
-	filecolor=black,
-	linkcolor=black,
-	linktoc=page,
-	urlcolor=black,
-	pdfstartview=FitH,
-	breaklinks=true,
-	pdfauthor={Blackfriday Markdown Processor v`)
-		io.WriteString(w, bf.Version)
-		io.WriteString(w, `},
-}
-
-\newcommand{\HRule}{\rule{\linewidth}{0.5mm}}
-\addtolength{\parskip}{0.5\baselineskip}
-`)
-
-		if r.Flags&NoParIndent != 0 {
-			io.WriteString(w, `\parindent=0pt
-`)
-		}
-
-		if title != "" {
-			io.WriteString(w, `
-\title{`+title+`}
-\author{`+r.Author+`}
-`)
-		}
-
-		io.WriteString(w, `
-\begin{document}
-`)
+	r.warnings = nil
+	r.unmapped = map[rune]bool{}
+	r.rtlWarned = false
+	r.appendix, r.appendixGroup = false, false
+	r.labels = collectLabels(ast)
+	if r.Metadata.Lang != "" && r.Languages == "" && babelLanguage(r.Metadata.Lang) == "" {
+		r.warn("unknown language %q", r.Metadata.Lang)
+	}
+	if class := r.requestedClass(); r.documentClass() != class && class != "" {
+		r.warn("unknown document class %q, using %s", class, ClassArticle)
+	}
+	if _, ok := Themes[r.Metadata.Theme]; r.Metadata.Theme != "" && r.Theme == nil && !ok {
+		r.warn("unknown theme %q", r.Metadata.Theme)
+	}
 
-		if title != "" {
-			r.w.WriteString(`
-\maketitle
-`)
-			if r.Flags&TOC != 0 {
-				r.w.WriteString(`\vfill
-\thispagestyle{empty}
+	r.skipped = nil
 
-\tableofcontents
-`)
-				if hasFigures(ast) {
-					io.WriteString(w, `\listoffigures
-`)
-				}
-				io.WriteString(w, `\clearpage
-`)
-			}
+	if r.Flags&CompletePage != 0 {
+		fm, skipped := r.frontMatter(ast)
+		data := r.templateData(ast, r.titleBlock(ast), fm)
+		r.preamblePackages(data)
+		data.Macros = r.macros()
+		r.execute(w, "header", data)
+		r.skipped = skipped
+	} else if r.Flags&ChapterTitle != 0 {
+		if data := r.templateData(ast, r.titleBlock(ast), frontMatter{}); strings.TrimSpace(data.Title) != "" {
+			r.execute(w, "chapter", data)
 		}
-
-		io.WriteString(w, "\n\n")
-	} else if r.Flags&ChapterTitle != 0 && strings.TrimSpace(title) != "" {
-		io.WriteString(w, `\chapter{`+title+"}\n\n")
 	}
 }
 
-// RenderHeader prints the '\end{document}' if CompletePage is on.
+// RenderFooter prints the '\end{document}' if CompletePage is on.
 func (r *Renderer) RenderFooter(w io.Writer, ast *bf.Node) {
+	if r.frameOpen {
+		io.WriteString(w, `\end{frame}`+"\n\n")
+		r.frameOpen = false
+	}
+	if r.appendixGroup {
+		io.WriteString(w, `\endgroup`+"\n")
+		r.appendixGroup = false
+	}
 	if r.Flags&CompletePage != 0 {
-		io.WriteString(w, `\end{document}`+"\n")
+		r.execute(w, "footer", r.templateData(ast, titleBlock{}, frontMatter{}))
 	}
 }
 
+// Warnings returns the problems found during the last rendering, such as
+// links to unknown labels.
+func (r *Renderer) Warnings() []string {
+	return r.warnings
+}
+
+func (r *Renderer) warn(format string, args ...interface{}) {
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
 // Render prints out the whole document from the ast, header and footer included.
 func (r *Renderer) Render(ast *bf.Node) []byte {
 	r.RenderHeader(&r.w, ast)
@@ -616,12 +729,16 @@ func (r *Renderer) Render(ast *bf.Node) []byte {
 }
 
 // Run prints out the whole document with CompletePage and TOC flags enabled.
+// The front matter of the input, if any, sets the document metadata. Keys
+// with values of the wrong type are ignored, and front matter that does not
+// parse is rendered as text.
 func Run(input []byte, opts ...bf.Option) []byte {
 	renderer := &Renderer{Flags: CompletePage | TOC}
+	renderer.Metadata, input, _ = ParseFrontMatter(input)
 
 	optList := []bf.Option{bf.WithRenderer(renderer), bf.WithExtensions(bf.CommonExtensions)}
 	optList = append(optList, opts...)
 	parser := bf.New(optList...)
-	ast := parser.Parse([]byte(input))
+	ast := parser.Parse(input)
 	return renderer.Render(ast)
 }
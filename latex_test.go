@@ -1,7 +1,11 @@
 package latex
 
 import (
+	"bytes"
+	"reflect"
+	"strings"
 	"testing"
+	"text/template"
 
 	// TODO: Update link on v2 release.
 	bf "github.com/russross/blackfriday/v2"
@@ -69,11 +73,18 @@ type testData struct {
 	want  string
 	flags Flag
 	ext   bf.Extensions
+	class DocumentClass
+
+	// Renderer overrides flags and class when set.
+	renderer *Renderer
 }
 
 func runTest(t *testing.T, tdt []testData) {
 	for _, v := range tdt {
-		renderer := &Renderer{Flags: v.flags}
+		renderer := v.renderer
+		if renderer == nil {
+			renderer = &Renderer{Flags: v.flags, DocumentClass: v.class}
+		}
 		md := bf.New(bf.WithRenderer(renderer), bf.WithExtensions(v.ext))
 		ast := md.Parse([]byte(v.input))
 		got := string(renderer.Render(ast))
@@ -97,7 +108,7 @@ func TestCodeBlock(t *testing.T) {
 	tdt := []testData{
 		{
 			input: `	foo`,
-			want: `\begin{lstlisting}[language=]
+			want: `\begin{lstlisting}
 foo
 \end{lstlisting}
 
@@ -106,7 +117,7 @@ foo
 			input: "``` go" + `
 foo
 ` + "```",
-			want: `\begin{lstlisting}[language=go]
+			want: `\begin{lstlisting}[language=Go]
 foo
 \end{lstlisting}
 
@@ -117,6 +128,70 @@ foo
 	runTest(t, tdt)
 }
 
+func TestCodeLanguage(t *testing.T) {
+	tdt := []testData{
+		{input: "``` c++\nfoo\n```", want: "\\begin{lstlisting}[language=C++]\nfoo\n\\end{lstlisting}\n\n", ext: bf.FencedCode},
+		{input: "``` JS\nfoo\n```", want: "\\begin{lstlisting}[language=JavaScript]\nfoo\n\\end{lstlisting}\n\n", ext: bf.FencedCode},
+		{input: "``` cs\nfoo\n```", want: "\\begin{lstlisting}[language={[Sharp]C}]\nfoo\n\\end{lstlisting}\n\n", ext: bf.FencedCode},
+		{input: "``` foo\nfoo\n```", want: "\\begin{lstlisting}\nfoo\n\\end{lstlisting}\n\n", ext: bf.FencedCode},
+	}
+
+	runTest(t, tdt)
+
+	renderer := &Renderer{Flags: CompletePage}
+	md := bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.FencedCode))
+	got := string(renderer.Render(md.Parse([]byte("``` ts\nfoo\n```\n\n``` py\nbar\n```\n\n``` foo\nbaz\n```\n"))))
+	js := strings.Index(got, `\lstdefinelanguage{JavaScript}{`)
+	ts := strings.Index(got, `\lstdefinelanguage{TypeScript}[]{JavaScript}{`)
+	if js < 0 || ts < js || strings.Contains(got, `\lstdefinelanguage{Python}`) {
+		t.Errorf("wrong language definitions in %q", got)
+	}
+	if want := []string{`unknown code language "foo"`}; !reflect.DeepEqual(renderer.Warnings(), want) {
+		t.Errorf("got warnings %q, want %q", renderer.Warnings(), want)
+	}
+}
+
+func TestCodeEngine(t *testing.T) {
+	tdt := []testData{
+		{input: "`foo`", want: `\mintinline{text}!foo!` + "\n", renderer: &Renderer{CodeEngine: CodeMinted}},
+		{input: "`foo`", want: `\Verb!foo!` + "\n", renderer: &Renderer{CodeEngine: CodeVerbatim}},
+		{input: "`a_b{\"c\"}`", want: `\texttt{a\_b\{\textquotedbl{}c\textquotedbl{}\}}` + "\n", renderer: &Renderer{CodeEngine: CodeHighlight}},
+		{
+			input:    "``` go\nfoo\n```",
+			want:     "\\begin{minted}{go}\nfoo\n\\end{minted}\n\n",
+			ext:      bf.FencedCode,
+			renderer: &Renderer{CodeEngine: CodeMinted},
+		},
+		{
+			input:    "\tfoo",
+			want:     "\\begin{Verbatim}\nfoo\n\\end{Verbatim}\n\n",
+			renderer: &Renderer{CodeEngine: CodeVerbatim},
+		},
+		{
+			input: "``` go\n" + `// Comment {}
+func main() {
+	s := "\n" + ` + "`raw\nstring`" + `
+	return 4.2
+}
+` + "```",
+			want: `\begin{Verbatim}[commandchars=\\\{\}]
+\textcolor{CodeComment}{\textit{// Comment \char123{}\char125{}}}
+\textcolor{CodeKeyword}{\textbf{func}} main() \char123{}
+	s := \textcolor{CodeString}{"\char92{}n"} + \textcolor{CodeString}{` + "`raw" + `}
+\textcolor{CodeString}{string` + "`" + `}
+	\textcolor{CodeKeyword}{\textbf{return}} \textcolor{CodeNumber}{4.2}
+\char125{}
+\end{Verbatim}
+
+`,
+			ext:      bf.FencedCode,
+			renderer: &Renderer{CodeEngine: CodeHighlight},
+		},
+	}
+
+	runTest(t, tdt)
+}
+
 func TestEmph(t *testing.T) {
 	tdt := []testData{
 		{input: `_foo_`, want: `\emph{foo}` + "\n"},
@@ -134,20 +209,51 @@ func TestEmph(t *testing.T) {
 
 func TestEscape(t *testing.T) {
 	tdt := []testData{
-		{input: `abcd#$%~_{}&`, want: `abcd\#\$\%\~\_\{\}\&` + "\n"},
+		{input: `abcd#$%~_{}&`, want: `abcd\#\$\%\textasciitilde{}\_\{\}\&` + "\n"},
+		{input: `a^b a|b`, want: `a\textasciicircum{}b a\textbar{}b` + "\n"},
+		{input: `a \< b \> c`, want: `a \textless{} b \textgreater{} c` + "\n"},
 		{input: `a\a\ `, want: `a\textbackslash{}a` + "\n"},
-		{input: `a\#\$\%\~\_\{\}\&`, want: `a\#\textbackslash{}\$\textbackslash{}\%\~\_\{\}\&` + "\n"},
+		{input: `a\#\$\%\~\_\{\}\&`, want: `a\#\textbackslash{}\$\textbackslash{}\%\textasciitilde{}\_\{\}\&` + "\n"},
 	}
 
 	runTest(t, tdt)
 }
 
+func TestEscapers(t *testing.T) {
+	tests := []struct {
+		escape func(*bytes.Buffer, []byte)
+		input  string
+		want   string
+	}{
+		{escapeCode, `a_b "c" ~`, `a\_b \textquotedbl{}c\textquotedbl{} \textasciitilde{}`},
+		{escapeURL, `http://a.b/{x}\y z?p=1%2&q#f`, `http://a.b/\%7Bx\%7D\%5Cy\%20z?p=1\%2&q\#f`},
+		{escapeCaption, "\"a\nb", `\enquote{a b}`},
+		{escapeTitle, "Jane Doe\nACME & Co", `Jane Doe\\` + "\n" + `ACME \& Co`},
+		{escapePDF, "a\n$b$", `a \$b\$`},
+		{escapeMath, `x_1 % y \% z #`, `x_1 \% y \% z \#`},
+	}
+	for _, test := range tests {
+		var w bytes.Buffer
+		test.escape(&w, []byte(test.input))
+		if got := w.String(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+
+	quoted := false
+	var w bytes.Buffer
+	escapeText(&w, []byte(`"a" "b`), &quoted)
+	if got, want := w.String(), `\enquote{a} \enquote{b`; got != want || !quoted {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
 func TestFootnote(t *testing.T) {
 	tdt := []testData{
 		{
 			input: `[^foo]
 [^foo]: bar`,
-			want: `\href{bar}{^foo}` + "\n",
+			want: `\href{bar}{\textasciicircum{}foo}` + "\n",
 		},
 		{
 			input: `[^foo]
@@ -160,6 +266,54 @@ func TestFootnote(t *testing.T) {
 	runTest(t, tdt)
 }
 
+func TestFragile(t *testing.T) {
+	tdt := []testData{
+		{
+			input: "# The `a_b` *field*",
+			want:  `\section{\texorpdfstring{The \texttt{a\_b} \emph{field}}{The a\_b field}}` + "\n",
+		},
+		{
+			input: "# Foo[^1]\n\n[^1]: `bar`",
+			want:  `\section{\texorpdfstring{Foo\protect\footnote{\texttt{bar}}}{Foo}}` + "\n",
+			ext:   bf.Footnotes,
+		},
+		{
+			input: "Foo[^1]\n\n[^1]: `bar` and ![baz](baz.png)\n\n        code\n",
+			want: `Foo\footnote{\texttt{bar} and \includegraphics[max width=\linewidth, max height=\baselineskip]{baz}
+
+\texttt{code}
+
+}` + "\n\n",
+			ext: bf.Footnotes,
+		},
+		{
+			input: `
+| a          | b     |
+|------------|-------|
+| ` + "`a_b`" + `[^1] | y[^2] |
+
+[^1]: foo
+[^2]: bar
+`,
+			want: `\begin{center}
+\begin{tabular}{ll}
+\textbf{a} & \textbf{b} \\
+\hline
+\texttt{a\_b}\footnotemark{} & y\footnotemark{} \\
+\end{tabular}
+\addtocounter{footnote}{-2}
+\stepcounter{footnote}\footnotetext{foo}
+\stepcounter{footnote}\footnotetext{bar}
+\end{center}
+
+`,
+			ext: bf.Tables | bf.Footnotes,
+		},
+	}
+
+	runTest(t, tdt)
+}
+
 func TestHardbreak(t *testing.T) {
 	tdt := []testData{
 		{
@@ -206,15 +360,53 @@ func TestImage(t *testing.T) {
 
 `,
 		},
+		{
+			input: `![Image 1](http://example.com/foo%20bar.jpg)`,
+			want:  `\url{http://example.com/foo\%20bar.jpg}` + "\n",
+		},
+		{
+			input: `![Image 1](foobar.jpg '"50%" of a_b')`,
+			want: `\begin{figure}[!ht]
+\begin{center}
+\includegraphics[max width=\textwidth, max height=\textheight]{foobar}
+\end{center}
+\caption{\enquote{50\%} of a\_b}
+\end{figure}
+
+`,
+		},
+		{
+			input: `![x](my_fig%201.png)`,
+			want: `\begin{center}
+\includegraphics[max width=\textwidth, max height=\textheight]{{\detokenize{my_fig 1}}}
+\end{center}
+
+`,
+		},
+		{
+			input: `# ![x](img/~a_b.png)`,
+			want:  `\section{\texorpdfstring{\includegraphics[max width=\linewidth, max height=\baselineskip]{\detokenize{img/~a_b}}}{x}}` + "\n",
+		},
 	}
 
 	runTest(t, tdt)
+
+	renderer := &Renderer{}
+	md := bf.New(bf.WithRenderer(renderer))
+	got := string(renderer.Render(md.Parse([]byte(`![x](50%25#1.png)`))))
+	if want := `{\detokenize{50\%\#1}}`; !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+	if want := []string{`image path "50%#1" holds characters LaTeX cannot load`}; !reflect.DeepEqual(renderer.Warnings(), want) {
+		t.Errorf("got warnings %q, want %q", renderer.Warnings(), want)
+	}
 }
 
 func TestLink(t *testing.T) {
 	tdt := []testData{
 		{input: `[foo](http://example.com)`, want: `\href{http://example.com}{foo}` + "\n"},
 		{input: `[foo](mailto://doe@example.com)`, want: `\href{mailto://doe@example.com}{foo}` + "\n"},
+		{input: `[foo](http://example.com/a%20b#top)`, want: `\href{http://example.com/a\%20b\#top}{foo}` + "\n"},
 		{
 			input: `http://example.com`,
 			want:  `\href{http://example.com}{http://example.com}` + "\n",
@@ -336,9 +528,328 @@ func TestSection(t *testing.T) {
 	runTest(t, tdt)
 }
 
+func TestDocumentClass(t *testing.T) {
+	tdt := []testData{
+		{input: `# foo`, want: `\section{foo}` + "\n", class: ClassArticle},
+		{input: `# foo`, want: `\chapter{foo}` + "\n", class: ClassReport},
+		{input: `###### foo`, want: `\subparagraph{foo} `, class: ClassBook},
+		{input: `# foo`, want: `\part{foo}` + "\n", class: ClassMemoir},
+		{input: `## foo`, want: `\chapter{foo}` + "\n", class: ClassMemoir},
+		{input: `# foo`, want: `\chapter{foo}` + "\n", class: ClassKOMABook},
+		{
+			input: "# foo\n\n## bar\n\nbaz\n\n## qux\n\n### quux\n",
+			want: `\section{foo}
+\begin{frame}[fragile]{bar}
+baz
+
+\end{frame}
+
+\begin{frame}[fragile]{qux}
+\textbf{quux} \end{frame}
+
+`,
+			class: ClassBeamer,
+		},
+		{
+			input: "Intro\n\n# foo\n\nbar\n\n## baz\n\nqux\n",
+			want: `\begin{frame}[fragile]
+Intro
+
+\end{frame}
+
+\section{foo}
+\begin{frame}[fragile]
+bar
+
+\end{frame}
+
+\begin{frame}[fragile]{baz}
+qux
+\end{frame}
+
+`,
+			class: ClassBeamer,
+		},
+		{
+			input: "% Title\n\n# foo\n",
+			want:  `\chapter{Title}` + "\n\n" + `\section{foo}` + "\n",
+			flags: ChapterTitle,
+			ext:   bf.Titleblock,
+		},
+		{
+			input: "% Title\n\n# foo\n",
+			want:  `\part{Title}` + "\n\n" + `\chapter{foo}` + "\n",
+			flags: ChapterTitle,
+			ext:   bf.Titleblock,
+			class: ClassBook,
+		},
+	}
+
+	runTest(t, tdt)
+
+	for class, want := range map[DocumentClass]string{
+		ClassArticle:     `\documentclass{article}`,
+		ClassKOMAArticle: `\documentclass[parskip=half]{scrartcl}`,
+	} {
+		renderer := &Renderer{Flags: CompletePage, DocumentClass: class}
+		got := string(renderer.Render(bf.New(bf.WithRenderer(renderer)).Parse([]byte("foo"))))
+		if !strings.HasPrefix(got, want+"\n") {
+			t.Errorf("got %q, want prefix %q", got, want)
+		}
+	}
+}
+
+func TestHeadingMap(t *testing.T) {
+	tdt := []testData{
+		{input: `# foo {-}`, want: `\section*{foo}` + "\n" + `\phantomsection` + "\n" + `\addcontentsline{toc}{section}{foo}` + "\n"},
+		{input: `# Preface {-}`, want: `\chapter*{Preface}` + "\n" + `\phantomsection` + "\n" + `\addcontentsline{toc}{chapter}{Preface}` + "\n", class: ClassReport},
+		{input: `## foo {.unnumbered}`, want: `\subsection*{foo}` + "\n" + `\phantomsection` + "\n" + `\addcontentsline{toc}{subsection}{foo}` + "\n"},
+		{
+			input: `# foo {#bar .unnumbered}`,
+			want:  `\section*{foo}` + "\n" + `\phantomsection\label{sec:bar}` + "\n" + `\addcontentsline{toc}{section}{foo}` + "\n",
+			ext:   bf.HeadingIDs,
+		},
+		{input: `# foo {bar}`, want: `\section{foo \{bar\}}` + "\n"},
+		{
+			input:    "# foo\n\n## bar\n\n###### baz",
+			want:     `\section{foo}` + "\n" + `\section{bar}` + "\n" + `\subparagraph{baz} `,
+			renderer: &Renderer{Headings: HeadingMap{Offset: -1}},
+		},
+		{
+			input:    "# foo\n\n## bar",
+			want:     `\subsection{foo}` + "\n" + `\subsubsection{bar}` + "\n",
+			renderer: &Renderer{Headings: HeadingMap{Offset: 1}},
+		},
+		{
+			input:    "# foo\n\n## bar\n\n### baz",
+			want:     `\chapter{foo}` + "\n" + `\section{bar}` + "\n" + `\textbf{baz} `,
+			renderer: &Renderer{Headings: HeadingMap{Commands: []string{"chapter", "section"}}},
+		},
+		{
+			input:    "# foo {#foo}\n\n## bar {#bar}",
+			want:     `\section{foo}\label{sec:foo}` + "\n" + `\phantomsection` + "\n" + `\label{sec:bar}\textbf{bar} `,
+			ext:      bf.HeadingIDs,
+			renderer: &Renderer{Headings: HeadingMap{Commands: []string{"section"}}},
+		},
+		{
+			input:    "#### foo",
+			want:     `\paragraph*{foo}` + "\n" + `\phantomsection` + "\n" + `\addcontentsline{toc}{paragraph}{foo} `,
+			renderer: &Renderer{Headings: HeadingMap{Unnumbered: true}},
+		},
+	}
+
+	runTest(t, tdt)
+
+	renderer := &Renderer{Flags: CompletePage, Metadata: Metadata{DocumentClass: "nope"}}
+	md := bf.New(bf.WithRenderer(renderer))
+	got := string(renderer.Render(md.Parse([]byte("# foo\n"))))
+	if want := "\\documentclass{article}\n"; !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+	want := []string{`unknown document class "nope", using article`}
+	if !reflect.DeepEqual(renderer.Warnings(), want) {
+		t.Errorf("got warnings %q, want %q", renderer.Warnings(), want)
+	}
+}
+
+func TestCrossRef(t *testing.T) {
+	tdt := []testData{
+		{
+			input: "# Foo bar\n\nSee [this](#foo-bar).",
+			want:  `\section{Foo bar}\label{sec:foo-bar}` + "\n" + `See \hyperref[sec:foo-bar]{this}.` + "\n",
+			ext:   bf.AutoHeadingIDs,
+		},
+		{
+			input: "# Foo {#foo}\n\nSee [#foo](#foo).",
+			want:  `\section{Foo}\label{sec:foo}` + "\n" + `See \ref{sec:foo}.` + "\n",
+			ext:   bf.HeadingIDs,
+		},
+		{
+			input: "# Foo {#sec:über_foo}\n",
+			want:  `\section{Foo}\label{sec:ufcber_foo}` + "\n",
+			ext:   bf.HeadingIDs,
+		},
+		{
+			input:    "# Foo {#foo}\n\nSee [section](#foo).",
+			want:     `\section{Foo}\label{sec:foo}` + "\n" + `See section~\ref{sec:foo}.` + "\n",
+			ext:      bf.HeadingIDs,
+			renderer: &Renderer{CrossRefs: CrossRefRef},
+		},
+		{
+			input:    "# Foo {#foo}\n\nSee [section](#foo).",
+			want:     `\section{Foo}\label{sec:foo}` + "\n" + `See \autoref{sec:foo}.` + "\n",
+			ext:      bf.HeadingIDs,
+			renderer: &Renderer{CrossRefs: CrossRefAutoref},
+		},
+		{
+			input: "# Foo {#foo}\n\nSee [ ](#foo), [<!-- -->](#foo) and [](#foo).",
+			want:  `\section{Foo}\label{sec:foo}` + "\n" + `See \ref{sec:foo}, \ref{sec:foo} and \ref{sec:foo}.` + "\n",
+			ext:   bf.HeadingIDs,
+		},
+		{
+			input: "# A {#a.b}\n\n# B {#a=b}\n\n# C {#é}\n\n# D {#ue9}\n\nSee [#a=b](#a=b) and [#ue9](#ue9).",
+			want: `\section{A}\label{sec:a.b}` + "\n" + `\section{B}\label{sec:a-b}` + "\n" + `\section{C}\label{sec:ue9}` + "\n" +
+				`\section{D}\label{sec:ue9-2}` + "\n" + `See \ref{sec:a-b} and \ref{sec:ue9-2}.` + "\n",
+			ext: bf.HeadingIDs,
+		},
+	}
+
+	runTest(t, tdt)
+
+	renderer := &Renderer{}
+	md := bf.New(bf.WithRenderer(renderer))
+	got := string(renderer.Render(md.Parse([]byte("See [nothing](#nowhere)."))))
+	if want := "See nothing.\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if want := []string{`unresolved link target "#nowhere"`}; !reflect.DeepEqual(renderer.Warnings(), want) {
+		t.Errorf("got warnings %q, want %q", renderer.Warnings(), want)
+	}
+
+	renderer = &Renderer{}
+	md = bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("See [](#nowhere)."))))
+	if want := "See \\ref{sec:nowhere}.\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if want := []string{`unresolved link target "#nowhere"`}; !reflect.DeepEqual(renderer.Warnings(), want) {
+		t.Errorf("got warnings %q, want %q", renderer.Warnings(), want)
+	}
+}
+
+func TestTeXMath(t *testing.T) {
+	tdt := []testData{
+		{input: `$x+y$`, want: `\$x+y\$` + "\n"},
+		{input: `$x+y$`, want: `$x+y$` + "\n", flags: TeXMath},
+		{input: `Let $x_1 = \alpha$ be.`, want: `Let $x_1 = \alpha$ be.` + "\n", flags: TeXMath},
+		{input: `$$E = mc^2$$`, want: `\[E = mc^2\]` + "\n", flags: TeXMath},
+		{input: `\\(a+b\\) and \\[c\\]`, want: `$a+b$ and \[c\]` + "\n", flags: TeXMath},
+		{input: `From $5 and $10.`, want: `From \$5 and \$10.` + "\n", flags: TeXMath},
+		{input: `Costs $5 and $10. Math $x^2$`, want: `Costs \$5 and \$10. Math $x^2$` + "\n", flags: TeXMath},
+		{input: `Between $5-$10.`, want: `Between \$5-\$10.` + "\n", flags: TeXMath},
+		{input: `$ x$ and $x $`, want: `\$ x\$ and \$x \$` + "\n", flags: TeXMath},
+		{input: `Pay \$5, not $\$5$.`, want: `Pay \$5, not $\$5$.` + "\n", flags: TeXMath},
+		{input: "`$x$`", want: `\lstinline!$x$!` + "\n", flags: TeXMath},
+		{input: `# $x$ {-}`, want: `\section*{$x$}` + "\n" + `\phantomsection` + "\n" + `\addcontentsline{toc}{section}{$x$}` + "\n", flags: TeXMath},
+	}
+
+	runTest(t, tdt)
+}
+
+func TestMathBlock(t *testing.T) {
+	tdt := []testData{
+		{
+			input: "``` math\nx+y\n```",
+			want:  "\\[\nx+y\n\\]\n\n",
+			ext:   bf.FencedCode,
+		},
+		{
+			input: "``` math {#eq:energy}\nE = mc^2\n```\n\nSee [@eq:energy], [](#eq:energy) and [#eq:energy](#eq:energy).",
+			want: `\begin{equation}\label{eq:energy}
+E = mc^2
+\end{equation}
+
+See \eqref{eq:energy}, \eqref{eq:energy} and \eqref{eq:energy}.
+`,
+			ext: bf.FencedCode,
+		},
+		{
+			input: "``` {.math .align #sum}\na &= b \\\\\nc &= d\n```\n\nSee [@sum; @sum] and [@unknown].",
+			want: `\begin{align}\label{eq:sum}
+a &= b \\
+c &= d
+\end{align}
+
+See \eqref{eq:sum}, \eqref{eq:sum} and [@unknown].
+`,
+			ext: bf.FencedCode,
+		},
+		{
+			input: "``` math {.gather}\nx\n```",
+			want:  "\\begin{gather*}\nx\n\\end{gather*}\n\n",
+			ext:   bf.FencedCode,
+		},
+		{
+			input: "``` math {#eq:x .equation -}\nx\n```",
+			want:  "\\begin{equation*}\nx\n\\end{equation*}\n\n",
+			ext:   bf.FencedCode,
+		},
+	}
+
+	runTest(t, tdt)
+}
+
+func TestUnicode(t *testing.T) {
+	tdt := []testData{
+		{input: `α → β ⇒ γ`, want: `\ensuremath{\alpha} → \ensuremath{\beta} \ensuremath{\Rightarrow} \ensuremath{\gamma}` + "\n"},
+		{input: `Ω and Α`, want: `\ensuremath{\Omega} and \ensuremath{\mathrm{A}}` + "\n"},
+		{input: `ℝ ✔ ∞`, want: `\ensuremath{\mathbb{R}} \ding{52} \ensuremath{\infty}` + "\n"},
+		{input: "Café – “ok” ┌─┐", want: "Café – “ok” ┌─┐\n"},
+		{input: "`a ≈ b`", want: `\texttt{a \ensuremath{\approx} b}` + "\n", renderer: &Renderer{CodeEngine: CodeHighlight}},
+	}
+
+	runTest(t, tdt)
+
+	renderer := &Renderer{UnicodePlaceholder: `\textbf{?}`}
+	md := bf.New(bf.WithRenderer(renderer))
+	got := string(renderer.Render(md.Parse([]byte("A 😀 and 😀."))))
+	if want := `A \textbf{?} and \textbf{?}.` + "\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if want := []string{`unsupported character '😀' (U+1F600)`}; !reflect.DeepEqual(renderer.Warnings(), want) {
+		t.Errorf("got warnings %q, want %q", renderer.Warnings(), want)
+	}
+
+	// PDF strings are mapped too.
+	renderer = &Renderer{Flags: CompletePage, UnicodePlaceholder: "?", Authors: []Author{{Name: "Zoë 😀"}}}
+	md = bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("# *A* 😀 α\n"))))
+	for _, want := range []string{
+		`pdfauthor={Zoë ?},`,
+		`\section{\texorpdfstring{\emph{A} ? \ensuremath{\alpha}}{A ? \ensuremath{\alpha}}}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+	if want := []string{`unsupported character '😀' (U+1F600)`}; !reflect.DeepEqual(renderer.Warnings(), want) {
+		t.Errorf("got warnings %q, want %q", renderer.Warnings(), want)
+	}
+
+	md = bf.New()
+	ast := md.Parse([]byte("✓ ■ ┌ ∞\n\n    ✔ ∀\n"))
+	if got, want := unicodePackages(ast), []string{"amssymb", "pifont", "pmboxdraw"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got packages %q, want %q", got, want)
+	}
+
+	code := "Text.\n\n```go\nx → ∀ 中 ñ é\n```\n"
+	renderer = &Renderer{Flags: CompletePage}
+	md = bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.FencedCode))
+	got = string(renderer.Render(md.Parse([]byte(code))))
+	if want := `{£}{{\pounds}}1 {ñ}{{ñ}}1 {→}{{→}}1 {∀}{{\ensuremath{\forall}}}1 {中}{{}}1` + "\n}"; !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+	if strings.Contains(got, `\DeclareUnicodeCharacter{2200}`) {
+		t.Errorf("unexpected declaration in %q", got)
+	}
+	if want := []string{`unsupported character '中' (U+4E2D)`}; !reflect.DeepEqual(renderer.Warnings(), want) {
+		t.Errorf("got warnings %q, want %q", renderer.Warnings(), want)
+	}
+
+	renderer = &Renderer{Flags: CompletePage, CodeEngine: CodeVerbatim}
+	md = bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.FencedCode))
+	got = string(renderer.Render(md.Parse([]byte(code))))
+	if want := "\\DeclareUnicodeCharacter{2200}{\\ensuremath{\\forall}}\n\\DeclareUnicodeCharacter{4E2D}{}\n"; !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+	if strings.Contains(got, `\DeclareUnicodeCharacter{2192}`) {
+		t.Errorf("unexpected declaration of a native character in %q", got)
+	}
+}
+
 func TestStrikethrough(t *testing.T) {
 	tdt := []testData{
-		{input: `~~foo~~`, want: `\~\~foo\~\~` + "\n"},
+		{input: `~~foo~~`, want: `\textasciitilde{}\textasciitilde{}foo\textasciitilde{}\textasciitilde{}` + "\n"},
 		{input: `~~foo~~`, want: `\sout{foo}` + "\n", ext: bf.Strikethrough},
 	}
 
@@ -370,52 +881,262 @@ foo & bar & baz & qux \\
 |---------|
 | foo     |
 `,
-			want: `| default |
-|---------|
-| foo     |
+			want: `\textbar{} default \textbar{}
+\textbar{}---------\textbar{}
+\textbar{} foo     \textbar{}
 `,
 		},
-	}
+		{
+			input: `
+| a | b |
+|---|---|
+| 1 | 2 |
 
-	runTest(t, tdt)
-}
+Table: The ` + "`x`" + ` data[^1].
 
-func TestTitleblock(t *testing.T) {
-	tdt := []testData{
+[^1]: Note.
+`,
+			want: `\begin{table}[htbp]
+\centering
+\caption{The \texttt{x} data\protect\footnote{Note.}.}
+\begin{tabular}{ll}
+\textbf{a} & \textbf{b} \\
+\hline
+1 & 2 \\
+\end{tabular}
+\end{table}
+
+`,
+			ext:   bf.Tables | bf.Footnotes,
+			flags: TableCaptions,
+		},
 		{
-			input: `% Title
-% Continuing title
-Normal text`,
-			want: `Normal text
+			input: "| a |\n|---|\n| 1 |\n\n: Short.\n\nTable: not a caption.\n",
+			want: `\begin{table}[htbp]
+\centering
+\caption{Short.}
+\begin{tabular}{l}
+\textbf{a} \\
+\hline
+1 \\
+\end{tabular}
+\end{table}
+
+Table: not a caption.
 `,
-			ext: bf.Titleblock,
+			ext:   bf.Tables,
+			flags: TableCaptions,
 		},
 		{
-			input: `% Title
-% Continuing title
-Normal text`,
-			want: `\% Title
-\% Continuing title
-Normal text
+			input: "| a |\n|---|\n| 1 |\n\nTable: Text.\n",
+			want: `\begin{center}
+\begin{tabular}{l}
+\textbf{a} \\
+\hline
+1 \\
+\end{tabular}
+\end{center}
+
+Table: Text.
 `,
+			ext: bf.Tables,
 		},
 	}
 
 	runTest(t, tdt)
 }
 
-/*
-func TestDummy(t *testing.T) {
-	extensions := bf.CommonExtensions | bf.TOC | bf.Titleblock
-	extensions |= bf.Footnotes
-	flags := CompletePage
+func TestTOC(t *testing.T) {
+	input := "# A\n\n| a |\n|---|\n| 1 |\n\nTable: T.\n\n``` go {caption=\"Main loop\"}\nfor {}\n```\n"
+	renderer := &Renderer{Flags: CompletePage | TOC | TableCaptions, TOCDepth: 2, SecNumDepth: 1}
+	md := bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.CommonExtensions))
+	got := string(renderer.Render(md.Parse([]byte(input))))
+	for _, want := range []string{
+		"\\setcounter{tocdepth}{2}\n\\setcounter{secnumdepth}{1}\n",
+		"\\begin{document}\n\\tableofcontents\n\\listoftables\n\\lstlistoflistings\n\\clearpage\n",
+		"\\begin{lstlisting}[language=Go, caption={Main loop}]\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
 
-	ast := bf.Parse([]byte(input), bf.Options{Extensions: extensions})
-	renderer := Renderer{
-		Author:     "John Doe",
-		Languages:  "english,french",
-		Extensions: extensions,
-		Flags:      flags,
+	renderer = &Renderer{
+		Flags:         CompletePage | TOC | TableCaptions,
+		DocumentClass: ClassBook,
+		CodeEngine:    CodeMinted,
+		Headings:      HeadingMap{Offset: -1},
+		Metadata:      Metadata{TOCDepth: 1, SecNumDepth: 4},
+	}
+	md = bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.CommonExtensions))
+	got = string(renderer.Render(md.Parse([]byte(input))))
+	for _, want := range []string{
+		"\\setcounter{tocdepth}{0}\n\\setcounter{secnumdepth}{2}\n",
+		"\\tableofcontents\n\\listoftables\n\\clearpage\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+}
+
+func TestDivisions(t *testing.T) {
+	input := `<!-- frontmatter -->
+
+# Preface
+
+Text.
+
+<!-- mainmatter -->
+
+# One
+
+Body
+
+# Data {.appendix}
+
+More
+
+<!-- appendix -->
+
+# Code
+
+<!-- backmatter -->
+`
+	tdt := []testData{
+		{
+			input: input,
+			class: ClassBook,
+			want: `\frontmatter
+\chapter{Preface}
+Text.
+
+\mainmatter
+\chapter{One}
+Body
+
+\appendix
+\chapter{Data}
+More
+
+\chapter{Code}
+\backmatter
+`,
+		},
+		{
+			input: "% Title\n\n# One\n\n# Data {.appendix}\n\nMore\n",
+			flags: ChapterTitle,
+			ext:   bf.Titleblock,
+			want: `\chapter{Title}
+
+\section{One}
+\begingroup
+\setcounter{section}{0}
+\renewcommand{\thesection}{\thechapter.\Alph{section}}
+\section{Data}
+More
+\endgroup
+`,
+		},
+		{
+			input: "<!-- appendix -->\n\n# A\n\n<!-- other -->\n",
+			class: ClassBeamer,
+			want:  "\\appendix\n\\section{A}\n",
+		},
+	}
+
+	runTest(t, tdt)
+
+	renderer := &Renderer{}
+	md := bf.New(bf.WithRenderer(renderer))
+	renderer.Render(md.Parse([]byte(input)))
+	want := []string{
+		`\frontmatter needs the book, memoir or scrbook class`,
+		`\mainmatter needs the book, memoir or scrbook class`,
+		`\backmatter needs the book, memoir or scrbook class`,
+	}
+	if !reflect.DeepEqual(renderer.Warnings(), want) {
+		t.Errorf("got warnings %q, want %q", renderer.Warnings(), want)
+	}
+}
+
+func TestTitleblock(t *testing.T) {
+	tdt := []testData{
+		{
+			input: `% Title
+% Continuing title
+Normal text`,
+			want: `Normal text
+`,
+			ext: bf.Titleblock,
+		},
+		{
+			input: `% Title
+% Continuing title
+Normal text`,
+			want: `\% Title
+\% Continuing title
+Normal text
+`,
+		},
+	}
+
+	runTest(t, tdt)
+}
+
+func TestTitleblockFields(t *testing.T) {
+	input := "% Title\n% Jane Doe; John Roe\n% May 2024\n\nText\n"
+	render := func(renderer *Renderer) string {
+		md := bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.Titleblock))
+		return string(renderer.Render(md.Parse([]byte(input))))
+	}
+
+	got := render(&Renderer{Flags: CompletePage})
+	want := "\\title{Title}\n\\author{Jane Doe \\and John Roe}\n\\date{May 2024}\n"
+	if !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+
+	got = render(&Renderer{Flags: CompletePage, Title: "Other", Author: "Ann", Date: `\today`})
+	want = "\\title{Other}\n\\author{Ann}\n\\date{\\textbackslash{}today}\n"
+	if !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+
+	got = render(&Renderer{Flags: ChapterTitle})
+	if want := "\\chapter{Title}\n"; !strings.HasPrefix(got, want) {
+		t.Errorf("got %q, want prefix %q", got, want)
+	}
+
+	input = "% Energy $E = mc^2$\n% Ann\n\nText\n"
+	got = render(&Renderer{Flags: CompletePage | TeXMath})
+	want = "\\title{Energy $E = mc^2$}\n\\author{Ann}\n\n"
+	if !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+	if strings.Contains(got, `\date`) {
+		t.Errorf("unexpected date in %q", got)
+	}
+
+	got = render(&Renderer{Flags: CompletePage | TeXMath, Metadata: Metadata{Title: `Price \(x\) in $`, Subtitle: "$y$"}})
+	want = "\\title{Price $x$ in \\$\\\\\n\\large $y$}\n"
+	if !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+}
+
+/*
+func TestDummy(t *testing.T) {
+	extensions := bf.CommonExtensions | bf.TOC | bf.Titleblock
+	extensions |= bf.Footnotes
+	flags := CompletePage
+
+	ast := bf.Parse([]byte(input), bf.Options{Extensions: extensions})
+	renderer := Renderer{
+		Author:     "John Doe",
+		Languages:  "english,french",
+		Extensions: extensions,
+		Flags:      flags,
 	}
 
 	fmt.Printf("%s\n", renderer.Render(ast))
@@ -441,3 +1162,919 @@ func BenchmarkRender(b *testing.B) {
 		renderer.Render(ast)
 	}
 }
+
+func TestEngine(t *testing.T) {
+	input := []byte("α and ✔\n")
+	render := func(renderer *Renderer) string {
+		md := bf.New(bf.WithRenderer(renderer))
+		return string(renderer.Render(md.Parse(input)))
+	}
+
+	got := render(&Renderer{Flags: CompletePage, Languages: "english,ngerman"})
+	for _, want := range []string{`\usepackage[utf8]{inputenc}`, `\usepackage{pifont}`, `literate=`, `\usepackage[english,ngerman]{babel}`, `\ensuremath{\alpha} and \ding{52}`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+
+	for _, engine := range []Engine{EngineXeLaTeX, EngineLuaLaTeX} {
+		got = render(&Renderer{Flags: CompletePage, Engine: engine, Languages: "english,ngerman", MonoFont: "Fira Mono"})
+		for _, want := range []string{
+			"\\usepackage{fontspec}\n\\setmonofont{Fira Mono}\n",
+			`\usepackage{unicode-math}`,
+			"\\usepackage{polyglossia}\n\\setdefaultlanguage[spelling=new]{german}\n\\setotherlanguage{english}\n",
+			"α and ✔",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("missing %q in %q", want, got)
+			}
+		}
+		for _, unwanted := range []string{`inputenc`, `\DeclareUnicodeCharacter`, `literate=`, `babel`, `pifont`} {
+			if strings.Contains(got, unwanted) {
+				t.Errorf("unexpected %q in %q", unwanted, got)
+			}
+		}
+	}
+}
+
+func TestMultilingual(t *testing.T) {
+	input := "Hello 你好，世界! and שלום עולם. Also こんにちは."
+	tdt := []testData{
+		{input: input, want: input + "\n", renderer: &Renderer{Engine: EngineXeLaTeX}},
+		{
+			input:    input,
+			want:     `Hello 你好，世界! and \texthebrew{שלום עולם}. Also こんにちは.` + "\n",
+			renderer: &Renderer{Flags: Multilingual, Engine: EngineXeLaTeX},
+		},
+		{
+			input:    "Hello 你好，世界! and こんにちは or 안녕",
+			want:     `Hello \begin{CJK}{UTF8}{gbsn}你好，世界\end{CJK}! and \begin{CJK}{UTF8}{min}こんにちは\end{CJK} or \begin{CJK}{UTF8}{mj}안녕\end{CJK}` + "\n",
+			renderer: &Renderer{Flags: Multilingual},
+		},
+		{
+			input:    "Say مرحبا \"now\"",
+			want:     `Say \textarabic{مرحبا} \enquote{now}` + "\n",
+			renderer: &Renderer{Flags: Multilingual, Engine: EngineLuaLaTeX},
+		},
+	}
+
+	runTest(t, tdt)
+
+	renderer := &Renderer{Flags: CompletePage | Multilingual, Engine: EngineXeLaTeX, CJKFont: "Noto Serif CJK SC", HebrewFont: "David CLM"}
+	md := bf.New(bf.WithRenderer(renderer))
+	got := string(renderer.Render(md.Parse([]byte(input))))
+	for _, want := range []string{
+		"\\usepackage{xeCJK}\n\\setCJKmainfont{Noto Serif CJK SC}\n",
+		"\\setdefaultlanguage{english}\n\\setotherlanguage{hebrew}\n\\newfontfamily\\hebrewfont[Script=Hebrew]{David CLM}\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+
+	renderer = &Renderer{Flags: Multilingual}
+	md = bf.New(bf.WithRenderer(renderer))
+	renderer.Render(md.Parse([]byte("שלום")))
+	if want := "right-to-left text needs XeLaTeX or LuaLaTeX"; len(renderer.Warnings()) == 0 || renderer.Warnings()[0] != want {
+		t.Errorf("got warnings %q, want %q first", renderer.Warnings(), want)
+	}
+
+	// pdfLaTeX still compiles the document, with placeholders.
+	renderer = &Renderer{Flags: CompletePage | Multilingual, UnicodePlaceholder: "?"}
+	md = bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("שלום"))))
+	if want := "\n????\n"; !strings.Contains(got, want) || strings.Contains(got, "GenericError") {
+		t.Errorf("got %q, want %q and no error", got, want)
+	}
+
+	renderer = &Renderer{
+		Flags:    CompletePage | Multilingual,
+		Engine:   EngineXeLaTeX,
+		Metadata: Metadata{Title: "Notes on שלום", Authors: []Author{{Name: "مريم"}}},
+	}
+	md = bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("Text"))))
+	for _, want := range []string{
+		"\\setotherlanguage{hebrew}\n",
+		"\\setotherlanguage{arabic}\n",
+		"\\title{Notes on \\texthebrew{שלום}}\n\\author{\\textarabic{مريم}}\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+}
+
+func TestFrontMatter(t *testing.T) {
+	yaml := `---
+title: "A: Study"
+author:
+  - Jane Doe
+  - name: John Roe
+    affiliation: ACME
+abstract: |
+  First line.
+
+  Second line.
+keywords: [markdown, "latex, tex"]
+toc: yes
+# A comment.
+geometry: margin=2cm
+---
+Body
+`
+	meta, body, err := ParseFrontMatter([]byte(yaml))
+	want := Metadata{
+		Title:    "A: Study",
+		Authors:  []Author{{Name: "Jane Doe"}, {Name: "John Roe", Affiliation: "ACME"}},
+		Abstract: "First line.\n\nSecond line.",
+		Keywords: []string{"markdown", "latex, tex"},
+		TOC:      true,
+		Geometry: []string{"margin=2cm"},
+	}
+	if err != nil || !reflect.DeepEqual(meta, want) || string(body) != "Body\n" {
+		t.Errorf("got %#v, %q, %v, want %#v", meta, body, err, want)
+	}
+
+	toml := `+++
+title = "T"
+authors = [
+  "A",
+  'B',
+]
+abstract = """
+x
+y"""
+classoption = "twocolumn, 11pt"
+
+[[extra]]
+name = "ignored"
++++
+Body
+`
+	meta, body, err = ParseFrontMatter([]byte(toml))
+	want = Metadata{Title: "T", Authors: []Author{{Name: "A"}, {Name: "B"}}, Abstract: "x\ny", ClassOptions: []string{"twocolumn", "11pt"}}
+	if err != nil || !reflect.DeepEqual(meta, want) || string(body) != "Body\n" {
+		t.Errorf("got %#v, %q, %v, want %#v", meta, body, err, want)
+	}
+
+	for _, input := range []string{
+		"Body\n---\n",
+		"--- \nBody\n",
+		"---\n\nSome text.\n",
+		"---\n\nText\n\n---\n\nMore\n",
+		"---\ntitle: x\n",
+		"---\nSome text\n---\n",
+		"---",
+		"+++",
+	} {
+		meta, body, err = ParseFrontMatter([]byte(input))
+		if err != nil || !reflect.DeepEqual(meta, Metadata{}) || string(body) != input {
+			t.Errorf("got %#v, %q, %v for %q", meta, body, err, input)
+		}
+	}
+
+	for _, input := range []string{"---\ntoc: maybe\n---\n", "---\ntitle: [a, b]\n---\n", "+++\ntitle\n+++\n"} {
+		if _, _, err = ParseFrontMatter([]byte(input)); err == nil {
+			t.Errorf("no error for %q", input)
+		}
+	}
+}
+
+func TestFrontMatterOrder(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		meta, _, err := ParseFrontMatter([]byte("---\nauthors: [A, B]\nauthor: C\ntitle: T\nTitle: U\n---\n"))
+		if err != nil || !reflect.DeepEqual(meta.Authors, []Author{{Name: "A"}, {Name: "B"}}) || meta.Title != "T" {
+			t.Fatalf("got %#v, %v", meta, err)
+		}
+	}
+}
+
+func TestFrontMatterErrors(t *testing.T) {
+	yaml := []struct {
+		input, want string
+	}{
+		{"a: 1\nb", "line 3: expected a key"},
+		{"a: 1\n  b: 2", "line 3: unexpected indentation"},
+		{`a: "x`, "unterminated string"},
+		{`a: "x" y`, `unexpected "y" after string`},
+		{"a: 'x", "unterminated string"},
+		{"a: [x, y", "unterminated list"},
+		{"a:\n  - [x", "unterminated list"},
+	}
+	for _, test := range yaml {
+		_, err := parseYAML(strings.Split(test.input, "\n"))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: got error %v, want %q", test.input, err, test.want)
+		}
+	}
+
+	toml := []struct {
+		input, want string
+	}{
+		{"a", "line 2: expected key = value"},
+		{"a = \"\"\"x", "line 2: unterminated string"},
+		{"a = [\"x\",", "line 2: unterminated array"},
+		{"a = 'x", "unterminated string"},
+		{`a = "x`, "unterminated string"},
+		{"a = 1\nb = [x", "line 3: unterminated array"},
+	}
+	for _, test := range toml {
+		_, err := parseTOML(strings.Split(test.input, "\n"))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: got error %v, want %q", test.input, err, test.want)
+		}
+	}
+
+	for _, input := range []string{"+++\ntitle = \"x\"\n", "+++\na\n+++\n", "---\nauthor: [a, [b]]\n---\n", "---\ntoc-depth: x\n---\n", "---\nauthor:\n  - affiliation: A\n---\n"} {
+		if _, _, err := ParseFrontMatter([]byte(input)); err == nil {
+			t.Errorf("no error for %q", input)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	got := string(Run([]byte(`---
+title: On "Quotes"
+subtitle: A study
+author: [Jane Doe, John Roe]
+date: May 2024
+lang: de-AT
+documentclass: scrartcl
+classoption: 11pt
+header-includes: \usepackage{booktabs}
+bibliography: refs.bib
+---
+# Intro
+
+See [@knuth84; @lamport94].
+`)))
+	for _, want := range []string{
+		`\documentclass[parskip=half,11pt]{scrartcl}`,
+		`\usepackage[naustrian]{babel}`,
+		"\\usepackage{biblatex}\n\\addbibresource{refs.bib}\n",
+		"\\usepackage{booktabs}\n\\usepackage{hyperref}\n",
+		"}\n\n\\title{On \\enquote{Quotes}}\n\\subtitle{A study}\n\\author{Jane Doe \\and John Roe}\n\\date{May 2024}\n",
+		`See \autocite{knuth84,lamport94}.`,
+		"\\printbibliography\n\\end{document}\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+
+	renderer := &Renderer{
+		Flags:         CompletePage,
+		Author:        "Ann",
+		DocumentClass: ClassReport,
+		Metadata:      Metadata{Title: "T", Authors: []Author{{Name: "Bob"}}, DocumentClass: "book", Lang: "xx"},
+	}
+	md := bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("See [@nothing]."))))
+	for _, want := range []string{`\documentclass{report}`, `\author{Ann}`, `See [@nothing].`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+	if want := []string{`unknown language "xx"`, `unresolved reference "@nothing"`}; !reflect.DeepEqual(renderer.Warnings(), want) {
+		t.Errorf("got warnings %q, want %q", renderer.Warnings(), want)
+	}
+
+	// Keys of the wrong type are ignored.
+	got = string(Run([]byte("---\ntitle: [a, b]\ntoc: maybe\nauthor: Ann\n---\nSome text.\n")))
+	for _, want := range []string{`pdfauthor={Ann},`, "Some text.\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+	for _, s := range []string{"RENDERING ERROR", `\title{`} {
+		if strings.Contains(got, s) {
+			t.Errorf("unexpected %s in %q", s, got)
+		}
+	}
+	meta, body, err := ParseFrontMatter([]byte("---\nauthors: [A]\nauthor: [[B]]\n---\nText\n"))
+	if want := []Author{{Name: "A"}}; err == nil || !reflect.DeepEqual(meta.Authors, want) || string(body) != "Text\n" {
+		t.Errorf("got %#v, %q, %v, want %#v and an error", meta.Authors, body, err, want)
+	}
+	if got := string(Run([]byte("---\n\nSome text.\n"))); !strings.Contains(got, "\\HRule{}\nSome text.\n") {
+		t.Errorf("got %q, want a rule and the text", got)
+	}
+}
+
+func TestAuthors(t *testing.T) {
+	got := string(Run([]byte(`---
+title: T
+author:
+  - name: Jane Doe
+    affiliation: ACME
+    email: jane@acme.org
+    corresponding: true
+  - name: John Roe
+    affiliation: Uni
+    orcid: 0000-0002-1825-0097
+  - name: Al
+    affiliation: ACME
+---
+Body
+`)))
+	for _, want := range []string{
+		"\\usepackage{authblk}\n",
+		"\tpdfauthor={Jane Doe, John Roe, Al},\n",
+		`\author[1]{Jane Doe\thanks{Corresponding author, \href{mailto:jane@acme.org}{jane@acme.org}}}
+\author[2]{John Roe\thanks{ORCID \href{https://orcid.org/0000-0002-1825-0097}{0000-0002-1825-0097}}}
+\author[1]{Al}
+\affil[1]{ACME}
+\affil[2]{Uni}
+`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+
+	renderer := &Renderer{
+		Flags:         CompletePage,
+		DocumentClass: ClassBeamer,
+		Author:        "Ignored",
+		Authors: []Author{
+			{Name: "A & B", Affiliation: "X"},
+			{Name: "C", Affiliation: "Y", Email: "c@y.org"},
+		},
+	}
+	md := bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.Titleblock))
+	got = string(renderer.Render(md.Parse([]byte("% Title\n% D; E\n\nBody\n"))))
+	for _, want := range []string{
+		`\author{A \& B\inst{1} \and C\inst{2}\thanks{\href{mailto:c@y.org}{c@y.org}}}
+\institute{\inst{1}X \and \inst{2}Y}
+`,
+		`pdfauthor={A \& B, C},`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+	if strings.Contains(got, "authblk") {
+		t.Errorf("unexpected authblk in %q", got)
+	}
+
+	renderer = &Renderer{Flags: CompletePage}
+	md = bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.Titleblock))
+	got = string(renderer.Render(md.Parse([]byte("% Title\n% D \\_1; *E*\n\nBody\n"))))
+	for _, want := range []string{`\author{D \_1 \and \emph{E}}`, `pdfauthor={D \_1, E},`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+}
+
+func TestFrontSections(t *testing.T) {
+	got := string(Run([]byte(`---
+title: T
+keywords: [a, b]
+dedication: To *Ann*.
+---
+# Epigraph {.epigraph source="A. Poet"}
+
+Words.
+
+# Summary {.abstract}
+
+First.
+
+Second.
+
+# Intro
+
+Body
+`)))
+	for _, want := range []string{
+		"\\usepackage{epigraph}\n",
+		`\maketitle
+
+\clearpage
+\thispagestyle{empty}
+\vspace*{\stretch{1}}
+\begin{center}
+\itshape
+To \emph{Ann}.
+\end{center}
+\vspace*{\stretch{2}}
+\clearpage
+\epigraph{Words.}{A. Poet}
+\begin{abstract}
+First.
+
+Second.
+\end{abstract}
+\noindent\textbf{Keywords:} a, b
+\vfill
+`,
+		"\\clearpage\n\n\n\\section{Intro}\nBody\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+	if strings.Contains(got, "Summary") {
+		t.Errorf("unexpected abstract heading in %q", got)
+	}
+
+	renderer := &Renderer{
+		Flags:         CompletePage,
+		DocumentClass: ClassBook,
+		Metadata:      Metadata{Abstract: "Meta.", Epigraph: "E", EpigraphSource: "S"},
+	}
+	md := bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("# Abstract {.abstract}\n\nIgnored.\n\n## Keywords {.keywords}\n\nx, y\n\n# One\n"))))
+	for _, want := range []string{
+		"\\newenvironment{abstract}{\\chapter*{\\abstractname}}{}\n",
+		"\\epigraph{E}{S}\n\\begin{abstract}\nMeta.\n\\end{abstract}\n\\noindent\\textbf{Keywords:} x, y\n",
+		"\\chapter{One}\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+	if strings.Contains(got, "Ignored") {
+		t.Errorf("unexpected abstract section in %q", got)
+	}
+
+	meta, _, err := ParseFrontMatter([]byte("---\nepigraph:\n  text: Words.\n  source: A. Poet\n---\n"))
+	if want := (Metadata{Epigraph: "Words.", EpigraphSource: "A. Poet"}); err != nil || !reflect.DeepEqual(meta, want) {
+		t.Errorf("got %#v, %v, want %#v", meta, err, want)
+	}
+
+	// In presentations, the sections are not put in frames of their own.
+	renderer = &Renderer{Flags: CompletePage, DocumentClass: ClassBeamer}
+	md = bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.Titleblock))
+	got = string(renderer.Render(md.Parse([]byte("% T\n\n# Abstract {.abstract}\n\nText.\n\n# Talk\n\n## Slide\n\nBody\n"))))
+	if want := "\\begin{frame}\n\\begin{abstract}\nText.\n\\end{abstract}\n\\end{frame}\n"; !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+	if begin, end := strings.Count(got, `\begin{frame}`), strings.Count(got, `\end{frame}`); begin != 3 || end != 3 {
+		t.Errorf("got %d frames opened and %d closed, want 3 in %q", begin, end, got)
+	}
+
+	// Without the preamble, the sections stay in the body.
+	renderer = &Renderer{}
+	md = bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("# Abstract {.abstract}\n\nText.\n"))))
+	if want := "\\section{Abstract}\nText.\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	got := string(Run([]byte(`---
+documentclass: scrartcl
+classoption: twocolumn
+papersize: A4
+fontsize: 11
+margin-left: 3cm
+linestretch: 1.5
+---
+Text
+`)))
+	for _, want := range []string{
+		`\documentclass[parskip=half,fontsize=11pt,a4paper,twocolumn]{scrartcl}`,
+		`\usepackage[margin=1in,left=3cm]{geometry}`,
+		"\\usepackage{setspace}\n\\setstretch{1.5}\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+
+	renderer := &Renderer{
+		Flags:    CompletePage,
+		Layout:   Layout{Paper: "letter", Margin: "2cm", Landscape: Bool(true), TwoColumn: Bool(true), FontSize: "12pt"},
+		Metadata: Metadata{Geometry: []string{"top=1cm"}, Layout: Layout{Paper: "a4", Margin: "3cm"}},
+	}
+	md := bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("Text\n"))))
+	for _, want := range []string{
+		`\documentclass[12pt,letterpaper,landscape,twocolumn]{article}`,
+		`\usepackage[top=1cm,margin=2cm]{geometry}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+	if strings.Contains(got, "setspace") {
+		t.Errorf("unexpected setspace in %q", got)
+	}
+
+	renderer = &Renderer{
+		Flags:    CompletePage,
+		Layout:   Layout{Landscape: Bool(false), TwoColumn: Bool(false)},
+		Metadata: Metadata{ClassOptions: []string{"twocolumn", "draft"}, Layout: Layout{Landscape: Bool(true)}},
+	}
+	md = bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("Text\n"))))
+	if want := `\documentclass[draft]{article}`; !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+
+	renderer = &Renderer{
+		Flags:    CompletePage,
+		Layout:   Layout{Landscape: Bool(true)},
+		Metadata: Metadata{Layout: Layout{Landscape: Bool(false), TwoColumn: Bool(true)}},
+	}
+	md = bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("Text\n"))))
+	if want := `\documentclass[landscape,twocolumn]{article}`; !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+
+	renderer = &Renderer{Flags: CompletePage, DocumentClass: ClassBeamer, Layout: Layout{Paper: "a4", FontSize: "14pt"}}
+	md = bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("Text\n"))))
+	if want := `\documentclass[14pt]{beamer}`; !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+}
+
+func TestPageStyle(t *testing.T) {
+	renderer := &Renderer{
+		Flags: CompletePage | TOC,
+		PageStyle: PageStyle{
+			Header:         [3]PageField{FieldTitle, FieldNone, FieldLogo},
+			Footer:         [3]PageField{FieldClassification, FieldSection, FieldPageOfTotal},
+			Logo:           "img/my_logo.png",
+			Classification: "R&D only",
+		},
+	}
+	md := bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.Titleblock))
+	got := string(renderer.Render(md.Parse([]byte("% Title\n\nText\n"))))
+	for _, want := range []string{
+		`\usepackage{fancyhdr}
+\usepackage{lastpage}
+\pagestyle{fancy}
+\fancyhf{}
+\fancyhead[L]{Title}
+\fancyhead[R]{\includegraphics[height=\headheight]{\detokenize{img/my_logo}}}
+\fancyfoot[L]{\textbf{R\&D only}}
+\fancyfoot[C]{\leftmark}
+\fancyfoot[R]{\thepage{} of \pageref{LastPage}}
+\setlength{\headheight}{24pt}
+\fancypagestyle{plain}{\fancyhead{}\renewcommand{\headrulewidth}{0pt}}
+`,
+		"\\vfill\n\\thispagestyle{plain}\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+
+	renderer = &Renderer{Flags: CompletePage, PageStyle: PageStyle{Footer: [3]PageField{FieldLogo, FieldPage}}}
+	md = bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.Titleblock))
+	got = string(renderer.Render(md.Parse([]byte("% Title\n\nText\n"))))
+	if want := "\\fancyhf{}\n\\fancyfoot[C]{\\thepage}\n\\fancypagestyle"; !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+	if strings.Contains(got, "lastpage") {
+		t.Errorf("unexpected lastpage in %q", got)
+	}
+}
+
+func TestDraft(t *testing.T) {
+	renderer := &Renderer{
+		Flags: CompletePage,
+		Draft: Draft{Watermark: "DRAFT", Revision: "3", Banner: "R&D", LineNumbers: true},
+	}
+	md := bf.New(bf.WithRenderer(renderer))
+	got := string(renderer.Render(md.Parse([]byte("Text\n"))))
+	want := `\usepackage{draftwatermark}
+\SetWatermarkText{DRAFT}
+\SetWatermarkScale{1}
+\usepackage{eso-pic}
+\AddToShipoutPictureFG{\AtPageLowerLeft{\makebox[\paperwidth]{\raisebox{1.5em}{\footnotesize DRAFT -- revision 3 -- \today}}}}
+\AddToShipoutPictureFG{\AtPageUpperLeft{\makebox[\paperwidth]{\raisebox{-2em}{\textbf{R\&D}}}}}
+\usepackage{lineno}
+\linenumbers
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+	if !strings.HasSuffix(got, "\n\\begin{document}\n\n\nText\n\\end{document}\n") {
+		t.Errorf("got %q, want an unchanged body", got)
+	}
+
+	renderer = &Renderer{
+		Flags:         CompletePage,
+		DocumentClass: ClassBeamer,
+		Draft:         Draft{Revision: "4", Date: "May 2024", LineNumbers: true},
+	}
+	md = bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("Text\n"))))
+	if want := `\footnotesize DRAFT -- revision 4 -- May 2024}`; !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+	for _, s := range []string{"draftwatermark", "lineno", "AtPageUpperLeft"} {
+		if strings.Contains(got, s) {
+			t.Errorf("unexpected %s in %q", s, got)
+		}
+	}
+}
+
+func TestTheme(t *testing.T) {
+	theme, err := LoadTheme(strings.NewReader(`{"base": "corporate", "colors": {"Accent": "FF0000"}, "link-color": "Accent", "line-numbers": false}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(Themes["corporate"].Colors) != 2 {
+		t.Errorf("loading a theme changed its base: %v", Themes["corporate"].Colors)
+	}
+	renderer := &Renderer{Flags: CompletePage, Theme: theme}
+	md := bf.New(bf.WithRenderer(renderer))
+	got := string(renderer.Render(md.Parse([]byte("# A\n"))))
+	for _, want := range []string{
+		"\\usepackage{lmodern}\n\\usepackage{helvet}\n",
+		"\\renewcommand{\\familydefault}{\\sfdefault}\n",
+		"\\usepackage{xcolor}\n\\definecolor{Accent}{HTML}{FF0000}\n\\definecolor{CorporateBlue}{HTML}{1F4E79}\n",
+		"\\lstset{\n\tbreaklines=true,",
+		`keywordstyle=\bfseries\color{CorporateBlue},`,
+		"\tcitecolor=CorporateBlue,\n\tfilecolor=Accent,\n\tlinkcolor=Accent,\n",
+		`\titleformat*{\section}{\Large\bfseries\sffamily\color{CorporateBlue}}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+	if strings.Index(got, `\usepackage{titlesec}`) > strings.Index(got, `\usepackage{hyperref}`) {
+		t.Errorf("titlesec loaded after hyperref in %q", got)
+	}
+	if strings.Contains(got, `\titleformat{\chapter}`) {
+		t.Errorf("unexpected chapter format in %q", got)
+	}
+
+	renderer = &Renderer{Flags: CompletePage, DocumentClass: ClassReport, Theme: Themes["corporate"]}
+	md = bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("# A\n"))))
+	if want := "\\usepackage{titlesec}\n\\titleformat{\\chapter}[display]{\\normalfont\\huge\\bfseries\\sffamily\\color{CorporateBlue}}{\\chaptertitlename\\ \\thechapter}{20pt}{\\Huge}\n\\titleformat*{\\section}"; !strings.Contains(got, want) {
+		t.Errorf("missing %q in %q", want, got)
+	}
+
+	renderer = &Renderer{
+		Flags:         CompletePage,
+		DocumentClass: ClassKOMAArticle,
+		CodeEngine:    CodeMinted,
+		Metadata:      Metadata{Theme: "solarized"},
+	}
+	md = bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("# A\n"))))
+	for _, want := range []string{
+		"\\setminted{\n\tlinenos,\n\tbreaklines=true,\n\txleftmargin=2\\baselineskip,\n\tstyle=solarized-light,\n}\n",
+		"\\addtokomafont{disposition}{\\color{SolarizedBlue}}\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+	if strings.Contains(got, "titlesec") {
+		t.Errorf("unexpected titlesec in %q", got)
+	}
+
+	renderer = &Renderer{Metadata: Metadata{Theme: "nope"}}
+	md = bf.New(bf.WithRenderer(renderer))
+	renderer.Render(md.Parse([]byte("Text\n")))
+	if want := []string{`unknown theme "nope"`}; !reflect.DeepEqual(renderer.Warnings(), want) {
+		t.Errorf("got warnings %q, want %q", renderer.Warnings(), want)
+	}
+
+	if _, err := LoadTheme(strings.NewReader(`{"base": "nope"}`)); err == nil {
+		t.Errorf("got no error for an unknown base")
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	tmpl := DefaultTemplates()
+	template.Must(tmpl.New("preamble").Parse(`\documentclass{<<.Flags.String>>}` + "\n"))
+	template.Must(tmpl.New("footer").Parse(`\end{document}% <<.Title>>` + "\n"))
+
+	renderer := &Renderer{Flags: CompletePage, Templates: tmpl}
+	md := bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.Titleblock))
+	ast := md.Parse([]byte("% Title\n\nfoo\n"))
+	got := string(renderer.Render(ast))
+	if !strings.HasPrefix(got, `\documentclass{!<RENDERING ERROR: `) {
+		t.Errorf("got %q, want a rendering error", got)
+	}
+
+	tmpl = DefaultTemplates()
+	template.Must(tmpl.New("preamble").Parse(`\documentclass{report}` + "\n"))
+	renderer = &Renderer{Flags: CompletePage, Templates: tmpl}
+	md = bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.Titleblock))
+	ast = md.Parse([]byte("% Title\n\nfoo\n"))
+	got = string(renderer.Render(ast))
+	want := `\documentclass{report}
+
+\title{Title}
+\author{}
+
+\begin{document}
+
+\maketitle
+
+
+foo
+\end{document}
+`
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMinimalPreamble(t *testing.T) {
+	packages := map[string]string{
+		"euro":          `\usepackage{marvosym}`,
+		"math":          `\usepackage{amsmath}`,
+		"images":        `\usepackage[export]{adjustbox}`,
+		"code":          `\usepackage{listings}`,
+		"verbatim":      `\usepackage{verbatim}`,
+		"strikethrough": `\usepackage[normalem]{ulem}`,
+		"links":         `\usepackage{hyperref}`,
+		"quotes":        `\usepackage{csquotes}`,
+		"rules":         `\newcommand{\HRule}`,
+	}
+	tests := []struct {
+		input string
+		flags Flag
+		want  []string
+	}{
+		{input: "A note.\n\nWith two paragraphs.\n"},
+		{input: "Costs 5 €.\n", want: []string{"euro"}},
+		{input: "```math\nx^2\n```\n", want: []string{"math"}},
+		{input: "Inline $x^2$.\n", flags: TeXMath, want: []string{"math"}},
+		{input: "Costs $5.\n", want: nil},
+		{input: "![alt](image.png)\n", want: []string{"images"}},
+		{input: "![alt](https://example.com/image.png)\n", want: []string{"links"}},
+		{input: "Some `code`.\n", want: []string{"code"}},
+		{input: "~~Struck~~ text.\n", want: []string{"strikethrough"}},
+		{input: "See <https://example.com>.\n", want: []string{"links"}},
+		{input: "# A *title*\n", want: []string{"links"}},
+		{input: "# Preface {-}\n", want: []string{"links"}},
+		{input: "A footnote[^1].\n\n[^1]: Note.\n", want: nil},
+		{input: `Some "quoted" text.` + "\n", want: []string{"quotes"}},
+		{input: "Above\n\n---\n\nBelow\n", want: []string{"rules"}},
+		{input: "% A \"title\"\n%\n%\n\nText\n", want: []string{"quotes"}},
+	}
+	for _, tt := range tests {
+		renderer := &Renderer{Flags: CompletePage | MinimalPreamble | tt.flags}
+		md := bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.CommonExtensions|bf.Titleblock|bf.Footnotes))
+		got := string(renderer.Render(md.Parse([]byte(tt.input))))
+		checkPackages(t, got)
+		for name, pkg := range packages {
+			want := false
+			for _, w := range tt.want {
+				want = want || w == name
+			}
+			if strings.Contains(got, pkg) != want {
+				t.Errorf("%q: got %s %t, want %t in %q", tt.input, name, !want, want, got)
+			}
+		}
+	}
+
+	renderer := &Renderer{Flags: CompletePage}
+	md := bf.New(bf.WithRenderer(renderer))
+	got := string(renderer.Render(md.Parse([]byte("A note.\n"))))
+	for _, pkg := range packages {
+		if !strings.Contains(got, pkg) {
+			t.Errorf("missing %q in %q", pkg, got)
+		}
+	}
+
+	renderer = &Renderer{Flags: CompletePage | MinimalPreamble, Authors: []Author{{Name: "Ann", Email: "ann@example.com"}}}
+	md = bf.New(bf.WithRenderer(renderer))
+	got = string(renderer.Render(md.Parse([]byte("A note.\n"))))
+	if !strings.Contains(got, packages["links"]) {
+		t.Errorf("missing hyperref for the author email in %q", got)
+	}
+}
+
+func TestPreamble(t *testing.T) {
+	meta, body, err := ParseFrontMatter([]byte(`---
+packages:
+  - siunitx
+  - name: geometry
+    options: [landscape, margin=2cm]
+macros:
+  R: \mathbb{R}
+  pair: "(#1, #2)"
+header-includes:
+  - \usepackage[colorlinks]{hyperref}
+  - "\\usepackage{siunitx,booktabs}\n\\setlength{\\parskip}{0pt}"
+include-before: \frontmatter
+---
+Text
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPackages := []Package{{Name: "siunitx"}, {Name: "geometry", Options: []string{"landscape", "margin=2cm"}}}
+	if !reflect.DeepEqual(meta.Packages, wantPackages) {
+		t.Errorf("got packages %#v, want %#v", meta.Packages, wantPackages)
+	}
+	wantMacros := []Macro{{Name: "R", Definition: `\mathbb{R}`}, {Name: "pair", Definition: "(#1, #2)"}}
+	if !reflect.DeepEqual(meta.Macros, wantMacros) {
+		t.Errorf("got macros %#v, want %#v", meta.Macros, wantMacros)
+	}
+
+	renderer := &Renderer{
+		Flags:    CompletePage,
+		Metadata: meta,
+		Preamble: Preamble{
+			Packages:     []Package{{Name: "xcolor", Options: []string{"dvipsnames"}}, {Name: "siunitx", Options: []string{"per-mode=symbol"}}, {Name: "geometry", Options: []string{"margin=3cm"}}},
+			Macros:       []Macro{{Name: `\R`, Definition: `\mathbf{R}`}},
+			IncludeAfter: []string{`\backmatter`},
+		},
+	}
+	md := bf.New(bf.WithRenderer(renderer))
+	got := string(renderer.Render(md.Parse(body)))
+	for _, want := range []string{
+		"\\PassOptionsToPackage{per-mode=symbol}{siunitx}\n\\PassOptionsToPackage{dvipsnames}{xcolor}\n\\PassOptionsToPackage{colorlinks}{hyperref}\n\\documentclass{article}\n",
+		"\\usepackage[landscape,margin=3cm]{geometry}\n",
+		"\\usepackage{siunitx}\n\\usepackage{booktabs}\n\\usepackage{hyperref}\n",
+		"}\n\\newcommand{\\R}{\\mathbf{R}}\n\\newcommand{\\pair}[2]{(#1, #2)}\n\\setlength{\\parskip}{0pt}\n",
+		"\\begin{document}\n\\frontmatter\n",
+		"Text\n\\backmatter\n\\end{document}\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in %q", want, got)
+		}
+	}
+	if strings.Count(got, `\usepackage{hyperref}`) != 1 || strings.Contains(got, `{siunitx,booktabs}`) {
+		t.Errorf("duplicate packages in %q", got)
+	}
+	if strings.LastIndex(got, `\usepackage`) != strings.Index(got, `\usepackage{hyperref}`) {
+		t.Errorf("hyperref not loaded last in %q", got)
+	}
+	want := []string{`package geometry: option "margin=2cm" overridden`, `macro \R defined twice`}
+	if !reflect.DeepEqual(renderer.Warnings(), want) {
+		t.Errorf("got warnings %q, want %q", renderer.Warnings(), want)
+	}
+}
+
+// Check that the commands used by a document have their package loaded.
+func checkPackages(t *testing.T, doc string) {
+	t.Helper()
+	// Literate replacements of listings only apply to the characters found.
+	doc = strings.Replace(doc, `{€}{{\EUR}}1`, "", 1)
+	for _, c := range []struct{ command, pkg string }{
+		{`\EUR`, `\usepackage{marvosym}`},
+		{`\eqref`, `\usepackage{amsmath}`},
+		{`\begin{equation`, `\usepackage{amsmath}`},
+		{`\includegraphics[max`, `\usepackage[export]{adjustbox}`},
+		{`\lstset`, `\usepackage{listings}`},
+		{`\lstinline`, `\usepackage{listings}`},
+		{`\begin{lstlisting}`, `\usepackage{listings}`},
+		{`\fvset`, `\usepackage{fancyvrb}`},
+		{`\Verb`, `\usepackage{fancyvrb}`},
+		{`\setminted`, `\usepackage{minted}`},
+		{`\sout`, `\usepackage[normalem]{ulem}`},
+		{`\href`, `\usepackage{hyperref}`},
+		{`\url`, `\usepackage{hyperref}`},
+		{`\hypersetup`, `\usepackage{hyperref}`},
+		{`\texorpdfstring`, `\usepackage{hyperref}`},
+		{`\phantomsection`, `\usepackage{hyperref}`},
+		{`\enquote`, `\usepackage{csquotes}`},
+		{`\HRule{}`, `\newcommand{\HRule}`},
+		{`\color{`, `\usepackage{xcolor}`},
+		{`\textcolor`, `\usepackage{xcolor}`},
+		{`\colorlet`, `\usepackage{xcolor}`},
+		{`\definecolor`, `\usepackage{xcolor}`},
+	} {
+		if strings.Contains(doc, c.command) && !strings.Contains(doc, c.pkg) {
+			t.Errorf("%s used without %s in %q", c.command, c.pkg, doc)
+		}
+	}
+}
+
+func TestPreamblePackages(t *testing.T) {
+	input := "# A *title*\n\nSome `code`, \"quotes\" and ~~deleted~~ 5 €.\n\n```go\nfunc main() {}\n```\n\n![alt](image.png)\n\n---\n"
+	for _, renderer := range []*Renderer{
+		{Flags: CompletePage},
+		{Flags: CompletePage | MinimalPreamble},
+		{Flags: CompletePage | MinimalPreamble, CodeEngine: CodeHighlight},
+		{Flags: CompletePage | MinimalPreamble, CodeEngine: CodeVerbatim},
+		{Flags: CompletePage | MinimalPreamble, CodeEngine: CodeMinted},
+		{Flags: CompletePage | MinimalPreamble, Theme: Themes["solarized"]},
+		{Flags: CompletePage | MinimalPreamble, Theme: &Theme{LinkColor: "blue!50!black"}},
+		{Flags: CompletePage, Theme: Themes["corporate"], CodeEngine: CodeHighlight},
+	} {
+		md := bf.New(bf.WithRenderer(renderer), bf.WithExtensions(bf.CommonExtensions))
+		checkPackages(t, string(renderer.Render(md.Parse([]byte(input)))))
+	}
+
+	// The packages a custom template loads are not loaded again.
+	tmpl := DefaultTemplates()
+	template.Must(tmpl.New("preamble").Parse(`\documentclass{article}
+\usepackage{tikz}
+<<range .Packages>>\usepackage{<<.Name>>}
+<<end>>`))
+	renderer := &Renderer{Flags: CompletePage, Templates: tmpl, Preamble: Preamble{Packages: []Package{{Name: "tikz"}, {Name: "booktabs"}}}}
+	md := bf.New(bf.WithRenderer(renderer))
+	got := string(renderer.Render(md.Parse([]byte("Text\n"))))
+	if want := "\\documentclass{article}\n\\usepackage{tikz}\n\\usepackage{booktabs}\n\n"; !strings.HasPrefix(got, want) {
+		t.Errorf("got %q, want prefix %q", got, want)
+	}
+}
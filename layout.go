@@ -0,0 +1,168 @@
+package latex
+
+import "strings"
+
+// Layout controls the page layout. The zero value keeps the defaults: the
+// paper and font size of the class, margins of 1in, portrait orientation, one
+// column and single spacing.
+type Layout struct {
+	// Paper is the paper size, e.g. "a4" or "letter".
+	Paper string
+
+	// Margin is the margin of all sides, e.g. "2cm". Top, Bottom, Left and
+	// Right override it for one side.
+	Margin string
+	Top    string
+	Bottom string
+	Left   string
+	Right  string
+
+	// Landscape and TwoColumn select the orientation and the columns when
+	// not nil. False turns off those of the metadata, including the class
+	// options.
+	Landscape *bool
+	TwoColumn *bool
+
+	// FontSize is the base font size, e.g. "11pt".
+	FontSize string
+
+	// LineSpacing is the line spacing factor set with the setspace package,
+	// e.g. "1.5".
+	LineSpacing string
+}
+
+// Merge b into a. The fields set in b take precedence.
+func (a Layout) merge(b Layout) Layout {
+	for _, f := range []struct{ a, b *string }{
+		{&a.Paper, &b.Paper},
+		{&a.Margin, &b.Margin},
+		{&a.Top, &b.Top},
+		{&a.Bottom, &b.Bottom},
+		{&a.Left, &b.Left},
+		{&a.Right, &b.Right},
+		{&a.FontSize, &b.FontSize},
+		{&a.LineSpacing, &b.LineSpacing},
+	} {
+		if *f.b != "" {
+			*f.a = *f.b
+		}
+	}
+	for _, f := range []struct{ a, b **bool }{
+		{&a.Landscape, &b.Landscape},
+		{&a.TwoColumn, &b.TwoColumn},
+	} {
+		if *f.b != nil {
+			*f.a = *f.b
+		}
+	}
+	return a
+}
+
+// Bool returns a pointer to a boolean, for the optional fields of Layout.
+func Bool(v bool) *bool {
+	return &v
+}
+
+// Report whether an optional boolean is set and true.
+func isTrue(b *bool) bool {
+	return b != nil && *b
+}
+
+// Report whether an optional boolean is set and false.
+func isFalse(b *bool) bool {
+	return b != nil && !*b
+}
+
+// Return the class options the layout turns off.
+func (l Layout) offOptions() []string {
+	var options []string
+	if isFalse(l.Landscape) {
+		options = append(options, "landscape")
+	}
+	if isFalse(l.TwoColumn) {
+		options = append(options, "twocolumn")
+	}
+	return options
+}
+
+// Return the class options of the layout. KOMA-Script classes take the font
+// size as a key; presentations only take the font size.
+func (l Layout) classOptions(p classProfile) []string {
+	var options []string
+	if size := l.FontSize; size != "" {
+		if !strings.HasSuffix(size, "pt") {
+			size += "pt"
+		}
+		if p.koma {
+			size = "fontsize=" + size
+		}
+		options = append(options, size)
+	}
+	if p.beamer {
+		return options
+	}
+	if paper := strings.ToLower(l.Paper); paper != "" {
+		if !strings.HasSuffix(paper, "paper") {
+			paper += "paper"
+		}
+		options = append(options, paper)
+	}
+	if isTrue(l.Landscape) {
+		options = append(options, "landscape")
+	}
+	if isTrue(l.TwoColumn) {
+		options = append(options, "twocolumn")
+	}
+	return options
+}
+
+// Return the geometry keys of the margins.
+func (l Layout) geometry() []string {
+	var keys []string
+	for _, m := range []struct{ key, value string }{
+		{"margin", l.Margin},
+		{"top", l.Top},
+		{"bottom", l.Bottom},
+		{"left", l.Left},
+		{"right", l.Right},
+	} {
+		if m.value != "" {
+			keys = append(keys, m.key+"="+m.value)
+		}
+	}
+	return keys
+}
+
+// Return the layout of the renderer over that of the metadata.
+func (r *Renderer) layout() Layout {
+	return r.Metadata.Layout.merge(r.Layout)
+}
+
+// Remove options from a list.
+func removeOptions(list []string, options ...string) []string {
+	var kept []string
+	for _, l := range list {
+		found := false
+		for _, o := range options {
+			found = found || l == o
+		}
+		if !found {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+// Append options missing from a list.
+func appendOptions(list []string, options ...string) []string {
+	for _, o := range options {
+		found := false
+		for _, l := range list {
+			found = found || l == o
+		}
+		if !found {
+			list = append(list, o)
+		}
+	}
+	return list
+}
@@ -0,0 +1,144 @@
+package latex
+
+import "bytes"
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Return the index of the closing delimiter of a `$...$` span starting at
+// text[0], or -1 if there is none. Following Pandoc, the opening `$` must be
+// followed by a non-space character, and the next `$` ends the span, which
+// is not math if that `$` follows a space or precedes a digit. This leaves
+// currency amounts such as "$5 and $10" alone.
+func closingDollar(text []byte) int {
+	if len(text) < 3 || isSpace(text[1]) || text[1] == '$' {
+		return -1
+	}
+	for i := 1; i < len(text); i++ {
+		switch {
+		case text[i] == '\\':
+			i++
+		case text[i] != '$':
+		case isSpace(text[i-1]), i+1 < len(text) && isDigit(text[i+1]):
+			return -1
+		default:
+			return i
+		}
+	}
+	return -1
+}
+
+// Return the index of the closing delimiter of a display math span starting
+// at text[0], or -1.
+func closingDelimiter(text []byte, open, close string) int {
+	if !bytes.HasPrefix(text, []byte(open)) {
+		return -1
+	}
+	end := bytes.Index(text[len(open):], []byte(close))
+	if end <= 0 {
+		return -1
+	}
+	return len(open) + end
+}
+
+// Render text with TeX math spans: `$...$` and `\(...\)` for inline math,
+// `$$...$$` and `\[...\]` for display math. Math is written as is, except for
+// stray comment characters, and the rest is escaped.
+func (r *Renderer) texMath(text []byte) {
+	org := 0
+	flush := func(i int) {
+		r.esc(text[org:i])
+	}
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if i+1 >= len(text) {
+				break
+			}
+			switch text[i+1] {
+			case '$':
+				// Escaped dollar.
+				flush(i)
+				r.w.WriteString(`\$`)
+				i++
+				org = i + 1
+			case '(':
+				if end := closingDelimiter(text[i:], `\(`, `\)`); end >= 0 {
+					flush(i)
+					r.w.WriteByte('$')
+					escapeMath(&r.w, text[i+2:i+end])
+					r.w.WriteByte('$')
+					i += end + 1
+					org = i + 1
+				}
+			case '[':
+				if end := closingDelimiter(text[i:], `\[`, `\]`); end >= 0 {
+					flush(i)
+					r.w.WriteString(`\[`)
+					escapeMath(&r.w, text[i+2:i+end])
+					r.w.WriteString(`\]`)
+					i += end + 1
+					org = i + 1
+				}
+			}
+		case '$':
+			if end := closingDelimiter(text[i:], "$$", "$$"); end >= 0 {
+				flush(i)
+				r.w.WriteString(`\[`)
+				escapeMath(&r.w, text[i+2:i+end])
+				r.w.WriteString(`\]`)
+				i += end + 1
+				org = i + 1
+			} else if end := closingDollar(text[i:]); end >= 0 {
+				flush(i)
+				escapeMath(&r.w, text[i:i+end+1])
+				i += end
+				org = i + 1
+			} else {
+				// Skip the whole run of dollars so that "$$5" does not open a span.
+				for i+1 < len(text) && text[i+1] == '$' {
+					i++
+				}
+			}
+		}
+	}
+	flush(len(text))
+}
+
+// Render a `math` code block. Without attributes, the block is an unnumbered
+// `\[...\]`. An identifier, e.g. `{#eq:energy}`, numbers and labels it. The
+// `.align`, `.gather`, `.multline` and `.equation` classes select the
+// environment, which is starred unless the block has an identifier.
+func (r *Renderer) mathBlock(literal []byte, attrs attributes) {
+	env := ""
+	for _, e := range []string{"align", "gather", "multline", "equation"} {
+		if attrs.hasClass(e) {
+			env = e
+		}
+	}
+	numbered := attrs.id != "" && !attrs.unnumbered()
+	if env == "" && !numbered {
+		r.w.WriteString("\\[\n")
+		r.w.Write(literal)
+		r.w.WriteString("\\]\n\n")
+		return
+	}
+	if env == "" {
+		env = "equation"
+	}
+	if !numbered {
+		env += "*"
+	}
+	r.w.WriteString(`\begin{` + env + `}`)
+	if numbered {
+		r.w.WriteString(`\label{` + r.label(attrs.id, equationLabel) + `}`)
+	}
+	r.w.WriteByte('\n')
+	r.w.Write(literal)
+	r.env(env, false)
+}
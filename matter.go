@@ -0,0 +1,58 @@
+package latex
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// The document divisions. They are switched by a comment, e.g.
+// `<!-- appendix -->`, or by a heading class, e.g. `# Appendix {.appendix}`.
+var divisions = []string{"frontmatter", "mainmatter", "appendix", "backmatter"}
+
+var divisionComment = regexp.MustCompile(`^<!--\s*(frontmatter|mainmatter|appendix|backmatter)\s*-->$`)
+
+// Return the division an HTML block switches to, or the empty string.
+func commentDivision(html []byte) string {
+	if m := divisionComment.FindSubmatch(bytes.TrimSpace(html)); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// Return the division a heading switches to, or the empty string.
+func headingDivision(attrs attributes) string {
+	for _, d := range divisions {
+		if attrs.hasClass(d) {
+			return d
+		}
+	}
+	return ""
+}
+
+// Switch to a division of the document. Only book classes have front, main
+// and back matter. In a chapter of its own, the sections of the appendix are
+// lettered within the chapter instead of turning the next chapters into
+// appendices.
+func (r *Renderer) division(name string) {
+	if r.frameOpen {
+		r.w.WriteString(`\end{frame}` + "\n\n")
+		r.frameOpen = false
+	}
+
+	switch {
+	case name != "appendix" && !r.class().matter:
+		r.warn(`\%s needs the book, memoir or scrbook class`, name)
+	case name != "appendix":
+		r.w.WriteString(`\` + name + "\n")
+	case r.appendix:
+		// Already there.
+	case r.Flags&(CompletePage|ChapterTitle) == ChapterTitle && r.class().titleCommand == "chapter":
+		r.w.WriteString(`\begingroup` + "\n" +
+			`\setcounter{section}{0}` + "\n" +
+			`\renewcommand{\thesection}{\thechapter.\Alph{section}}` + "\n")
+		r.appendix, r.appendixGroup = true, true
+	default:
+		r.w.WriteString(`\appendix` + "\n")
+		r.appendix = true
+	}
+}
@@ -0,0 +1,784 @@
+package latex
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metadata is the document metadata found in the front matter.
+type Metadata struct {
+	Title    string
+	Subtitle string
+	Authors  []Author
+	Date     string
+	Keywords []string
+
+	// Abstract, Dedication and Epigraph are Markdown text. EpigraphSource is
+	// the plain text attribution of the epigraph.
+	Abstract       string
+	Dedication     string
+	Epigraph       string
+	EpigraphSource string
+
+	// Lang is the BCP 47 language of the document, e.g. "en-US".
+	Lang string
+
+	DocumentClass string
+	ClassOptions  []string
+
+	// Geometry are the options of the geometry package, e.g. "margin=2cm".
+	Geometry []string
+
+	// Theme is the name of the theme, e.g. "solarized".
+	Theme string
+
+	// Layout is set by the papersize, margin, margin-top, margin-bottom,
+	// margin-left, margin-right, fontsize and linestretch keys.
+	Layout Layout
+
+	// HeaderIncludes are raw LaTeX lines added at the end of the preamble.
+	HeaderIncludes []string
+
+	// IncludeBefore and IncludeAfter are raw LaTeX lines added right after
+	// `\begin{document}` and right before `\end{document}`.
+	IncludeBefore []string
+	IncludeAfter  []string
+
+	// Packages are the packages added to the preamble, given as names or as
+	// mappings with the name and options keys. Macros are given as a mapping
+	// from the macro names to their definitions.
+	Packages []Package
+	Macros   []Macro
+
+	// TOC requests the table of contents. TOCDepth and SecNumDepth are the
+	// deepest heading levels listed in it and numbered, 0 for the defaults.
+	TOC         bool
+	TOCDepth    int
+	SecNumDepth int
+
+	// Bibliography are the BibTeX files of the citations.
+	Bibliography []string
+}
+
+// ParseFrontMatter splits the YAML front matter, between `---` lines, or the
+// TOML front matter, between `+++` lines, from the Markdown input. The YAML
+// front matter may also end with a `...` line. The input is returned as is
+// when it has no front matter.
+//
+// As in Pandoc, a `---` line only opens front matter when it is followed by a
+// line that is not blank, and when the block is closed and parses as a
+// mapping. Otherwise it is a horizontal rule.
+//
+// Only the common subset of YAML and TOML is supported: strings, booleans,
+// lists, and nested mappings or tables. Keys with values of the wrong type,
+// e.g. a list as the title, are left out of the metadata, which is returned
+// with the body and the error.
+func ParseFrontMatter(input []byte) (Metadata, []byte, error) {
+	var meta Metadata
+	var parse func([]string) (map[string]interface{}, error)
+	var ends []string
+	switch firstLine(input) {
+	case "---":
+		parse, ends = parseYAML, []string{"---", "..."}
+	case "+++":
+		parse, ends = parseTOML, []string{"+++"}
+	default:
+		return meta, input, nil
+	}
+
+	yaml := ends[0] == "---"
+	var lines []string
+	i := bytes.IndexByte(input, '\n')
+	if i < 0 {
+		// No line follows the opening fence.
+		return meta, input, nil
+	}
+	rest := input[i+1:]
+	if yaml && strings.TrimSpace(firstLine(rest)) == "" {
+		return meta, input, nil
+	}
+	for len(rest) > 0 {
+		line := firstLine(rest)
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			rest = rest[i+1:]
+		} else {
+			rest = nil
+		}
+		for _, end := range ends {
+			if line == end {
+				values, err := parse(lines)
+				if err != nil && yaml {
+					return meta, input, nil
+				}
+				if err != nil {
+					return meta, input, err
+				}
+				err = meta.set(values)
+				return meta, rest, err
+			}
+		}
+		lines = append(lines, line)
+	}
+	if yaml {
+		return meta, input, nil
+	}
+	return meta, input, fmt.Errorf("front matter: missing closing %q", ends[0])
+}
+
+// Return the first line of text, without its line ending.
+func firstLine(text []byte) string {
+	if i := bytes.IndexByte(text, '\n'); i >= 0 {
+		text = text[:i]
+	}
+	return string(bytes.TrimRight(text, "\r"))
+}
+
+// Set the metadata from the front matter values. Unknown keys are ignored.
+// Keys are read in sorted order, so that the result does not depend on the
+// order of the map: "authors" wins over "author". A key with a value of the
+// wrong type is skipped, and the first such error is returned once the other
+// keys are set.
+func (m *Metadata) set(values map[string]interface{}) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var first error
+	for _, key := range keys {
+		value := values[key]
+		saved := *m
+		var err error
+		switch strings.ToLower(key) {
+		case "title":
+			m.Title, err = metaString(key, value)
+		case "subtitle":
+			m.Subtitle, err = metaString(key, value)
+		case "author", "authors":
+			m.Authors, err = metaAuthors(key, value)
+		case "date":
+			m.Date, err = metaString(key, value)
+		case "abstract":
+			m.Abstract, err = metaString(key, value)
+		case "dedication":
+			m.Dedication, err = metaString(key, value)
+		case "epigraph":
+			m.Epigraph, m.EpigraphSource, err = metaEpigraph(key, value)
+		case "keywords":
+			m.Keywords, err = metaList(key, value, true)
+		case "lang":
+			m.Lang, err = metaString(key, value)
+		case "documentclass":
+			m.DocumentClass, err = metaString(key, value)
+		case "classoption":
+			m.ClassOptions, err = metaList(key, value, true)
+		case "theme":
+			m.Theme, err = metaString(key, value)
+		case "papersize":
+			m.Layout.Paper, err = metaString(key, value)
+		case "margin":
+			m.Layout.Margin, err = metaString(key, value)
+		case "margin-top":
+			m.Layout.Top, err = metaString(key, value)
+		case "margin-bottom":
+			m.Layout.Bottom, err = metaString(key, value)
+		case "margin-left":
+			m.Layout.Left, err = metaString(key, value)
+		case "margin-right":
+			m.Layout.Right, err = metaString(key, value)
+		case "fontsize":
+			m.Layout.FontSize, err = metaString(key, value)
+		case "linestretch":
+			m.Layout.LineSpacing, err = metaString(key, value)
+		case "geometry":
+			m.Geometry, err = metaList(key, value, true)
+		case "header-includes":
+			m.HeaderIncludes, err = metaList(key, value, false)
+		case "include-before":
+			m.IncludeBefore, err = metaList(key, value, false)
+		case "include-after":
+			m.IncludeAfter, err = metaList(key, value, false)
+		case "packages":
+			m.Packages, err = metaPackages(key, value)
+		case "macros":
+			m.Macros, err = metaMacros(key, value)
+		case "toc":
+			m.TOC, err = metaBool(key, value)
+		case "toc-depth":
+			m.TOCDepth, err = metaInt(key, value)
+		case "secnumdepth":
+			m.SecNumDepth, err = metaInt(key, value)
+		case "bibliography":
+			m.Bibliography, err = metaList(key, value, false)
+		}
+		if err != nil {
+			*m = saved
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func metaString(key string, value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("front matter: %s: expected a string", key)
+}
+
+// Return the text and the source of an epigraph, given as a string or as a
+// mapping with the text and source keys.
+func metaEpigraph(key string, value interface{}) (text, source string, err error) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		text, err = metaString(key, value)
+		return
+	}
+	if text, err = metaString(key, m["text"]); err != nil {
+		return
+	}
+	if m["source"] != nil {
+		source, err = metaString(key, m["source"])
+	}
+	return
+}
+
+func metaInt(key string, value interface{}) (int, error) {
+	s, _ := value.(string)
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("front matter: %s: expected an integer", key)
+	}
+	return n, nil
+}
+
+func metaBool(key string, value interface{}) (bool, error) {
+	s, _ := value.(string)
+	switch strings.ToLower(s) {
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("front matter: %s: expected a boolean", key)
+}
+
+// Return a list of strings. A string is a list of one element, or a
+// comma-separated list if split is set.
+func metaList(key string, value interface{}, split bool) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		if !split {
+			return []string{v}, nil
+		}
+		var list []string
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		return list, nil
+	case []interface{}:
+		var list []string
+		for _, item := range v {
+			s, err := metaString(key, item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("front matter: %s: expected a list", key)
+}
+
+// Return a list of packages. A package is a name, or a mapping with the name
+// and options keys, the options being a list or a comma-separated string.
+func metaPackages(key string, value interface{}) ([]Package, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		list = []interface{}{value}
+	}
+	var packages []Package
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			name, err := metaString(key, item)
+			if err != nil {
+				return nil, err
+			}
+			packages = append(packages, Package{Name: name})
+			continue
+		}
+		var p Package
+		var err error
+		if m["name"] != nil {
+			p.Name, err = metaString(key, m["name"])
+		}
+		if err == nil && m["options"] != nil {
+			p.Options, err = metaList(key, m["options"], true)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p.Name == "" {
+			return nil, fmt.Errorf("front matter: %s: missing name", key)
+		}
+		packages = append(packages, p)
+	}
+	return packages, nil
+}
+
+// Return the macros of a mapping from names to definitions, sorted by name.
+func metaMacros(key string, value interface{}) ([]Macro, error) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("front matter: %s: expected a mapping", key)
+	}
+	var macros []Macro
+	for name, v := range m {
+		definition, err := metaString(key, v)
+		if err != nil {
+			return nil, err
+		}
+		macros = append(macros, Macro{Name: name, Definition: definition})
+	}
+	sort.Slice(macros, func(i, j int) bool { return macros[i].Name < macros[j].Name })
+	return macros, nil
+}
+
+// Return a list of authors. An author is a name, or a mapping with the name,
+// affiliation, email, orcid and corresponding keys.
+func metaAuthors(key string, value interface{}) ([]Author, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		list = []interface{}{value}
+	}
+	var authors []Author
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			name, err := metaString(key, item)
+			if err != nil {
+				return nil, err
+			}
+			authors = append(authors, Author{Name: name})
+			continue
+		}
+		var author Author
+		for k, v := range m {
+			var err error
+			switch strings.ToLower(k) {
+			case "name":
+				author.Name, err = metaString(key, v)
+			case "affiliation":
+				author.Affiliation, err = metaString(key, v)
+			case "email":
+				author.Email, err = metaString(key, v)
+			case "orcid":
+				author.ORCID, err = metaString(key, v)
+			case "corresponding":
+				author.Corresponding, err = metaBool(key, v)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if author.Name == "" {
+			return nil, fmt.Errorf("front matter: %s: missing name", key)
+		}
+		authors = append(authors, author)
+	}
+	return authors, nil
+}
+
+// Return the indentation of a line.
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// Report whether a YAML line is blank or a comment.
+func yamlBlank(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || line[0] == '#'
+}
+
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+func parseYAML(lines []string) (map[string]interface{}, error) {
+	p := &yamlParser{lines: lines}
+	p.skipBlank()
+	if p.pos == len(p.lines) {
+		return map[string]interface{}{}, nil
+	}
+	m, err := p.mapping(indentation(p.lines[p.pos]))
+	if err == nil && p.pos < len(p.lines) {
+		err = p.error("unexpected indentation")
+	}
+	return m, err
+}
+
+func (p *yamlParser) error(msg string) error {
+	return fmt.Errorf("front matter: line %d: %s", p.pos+2, msg)
+}
+
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) && yamlBlank(p.lines[p.pos]) {
+		p.pos++
+	}
+}
+
+// Report whether the next line is a list item at the given indentation.
+func (p *yamlParser) isItem(indent int) bool {
+	if p.pos == len(p.lines) || indentation(p.lines[p.pos]) != indent {
+		return false
+	}
+	line := strings.TrimSpace(p.lines[p.pos])
+	return line == "-" || strings.HasPrefix(line, "- ")
+}
+
+// Parse the mapping whose keys are at the given indentation.
+func (p *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	for p.skipBlank(); p.pos < len(p.lines) && indentation(p.lines[p.pos]) == indent && !p.isItem(indent); p.skipBlank() {
+		line := strings.TrimSpace(p.lines[p.pos])
+		key, rest := yamlKey(line)
+		if key == "" {
+			return nil, p.error("expected a key")
+		}
+		p.pos++
+		value, err := p.value(indent, rest)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+// Split a `key: value` line. The key is empty if the line has none.
+func yamlKey(line string) (string, string) {
+	i := strings.Index(line+" ", ": ")
+	if i <= 0 || line[0] == '"' || line[0] == '\'' || line[0] == '[' {
+		return "", line
+	}
+	if i+2 > len(line) {
+		return strings.TrimSpace(line[:i]), ""
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+2:])
+}
+
+// Parse the value of a key at the given indentation, rest being the end of the
+// key line.
+func (p *yamlParser) value(indent int, rest string) (interface{}, error) {
+	switch {
+	case rest == "":
+		p.skipBlank()
+		switch {
+		case p.isItem(indent), p.pos < len(p.lines) && p.isItem(indentation(p.lines[p.pos])) && indentation(p.lines[p.pos]) > indent:
+			return p.list(indentation(p.lines[p.pos]))
+		case p.pos < len(p.lines) && indentation(p.lines[p.pos]) > indent:
+			return p.mapping(indentation(p.lines[p.pos]))
+		}
+		return "", nil
+	case rest[0] == '|' || rest[0] == '>':
+		return p.blockScalar(indent, rest[0] == '>'), nil
+	}
+	return yamlScalar(rest)
+}
+
+// Parse the list whose items are at the given indentation.
+func (p *yamlParser) list(indent int) ([]interface{}, error) {
+	var list []interface{}
+	for p.skipBlank(); p.isItem(indent); p.skipBlank() {
+		item := strings.TrimSpace(p.lines[p.pos])[1:]
+		if key, _ := yamlKey(strings.TrimSpace(item)); key != "" {
+			// A mapping: parse it as if the dash was a space.
+			p.lines[p.pos] = strings.Repeat(" ", indent+1) + item
+			m, err := p.mapping(indentation(p.lines[p.pos]))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, m)
+			continue
+		}
+		p.pos++
+		value, err := p.value(indent, strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+// Parse a `|` literal or `>` folded block scalar.
+func (p *yamlParser) blockScalar(indent int, folded bool) string {
+	var lines []string
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if indentation(line) <= indent {
+			break
+		}
+		if blockIndent < 0 || indentation(line) < blockIndent {
+			blockIndent = indentation(line)
+		}
+		lines = append(lines, line[blockIndent:])
+	}
+	text := strings.Trim(strings.Join(lines, "\n"), "\n")
+	if folded {
+		// Lines are joined, but blank lines are kept as line breaks.
+		var paragraphs []string
+		for _, par := range strings.Split(text, "\n\n") {
+			paragraphs = append(paragraphs, strings.Join(strings.Fields(par), " "))
+		}
+		text = strings.Join(paragraphs, "\n\n")
+	}
+	return text
+}
+
+// Parse a YAML scalar or flow list.
+func yamlScalar(text string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, "["):
+		return flowList(text, yamlScalar)
+	case strings.HasPrefix(text, `"`):
+		s, rest, err := quotedString(text)
+		if err == nil && !yamlBlank(rest) {
+			err = fmt.Errorf("front matter: unexpected %q after string", rest)
+		}
+		return s, err
+	case strings.HasPrefix(text, "'"):
+		end := strings.Index(strings.ReplaceAll(text[1:], "''", "  "), "'")
+		if end < 0 {
+			return nil, fmt.Errorf("front matter: unterminated string %s", text)
+		}
+		return strings.ReplaceAll(text[1:end+1], "''", "'"), nil
+	}
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// Parse a double-quoted string at the start of text, with backslash escapes,
+// and return the rest of the text.
+func quotedString(text string) (string, string, error) {
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			s, err := strconv.Unquote(text[:i+1])
+			return s, strings.TrimSpace(text[i+1:]), err
+		}
+	}
+	return "", "", fmt.Errorf("front matter: unterminated string %s", text)
+}
+
+// Parse a `[a, b]` list, whose elements are parsed with scalar. Elements may
+// be quoted strings or lists holding commas.
+func flowList(text string, scalar func(string) (interface{}, error)) ([]interface{}, error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasSuffix(text, "]") {
+		return nil, fmt.Errorf("front matter: unterminated list %s", text)
+	}
+	var list []interface{}
+	var quote byte
+	depth, org := 0, 1
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		case c == ',' && depth == 0, i == len(text)-1:
+			if item := strings.TrimSpace(text[org:i]); item != "" {
+				value, err := scalar(item)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			}
+			org = i + 1
+		}
+	}
+	return list, nil
+}
+
+// Parse TOML front matter: `key = value` lines, `[table]` and `[[array]]`
+// headers.
+func parseTOML(lines []string) (map[string]interface{}, error) {
+	root := map[string]interface{}{}
+	table := root
+	for n := 0; n < len(lines); n++ {
+		line := strings.TrimSpace(lines[n])
+		start := n
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("front matter: line %d: %s", start+2, fmt.Sprintf(format, args...))
+		}
+		switch {
+		case line == "" || line[0] == '#':
+			continue
+		case strings.HasPrefix(line, "[["):
+			name := strings.TrimSpace(strings.TrimSuffix(line[2:], "]]"))
+			list, _ := root[name].([]interface{})
+			table = map[string]interface{}{}
+			root[name] = append(list, table)
+			continue
+		case strings.HasPrefix(line, "["):
+			table = map[string]interface{}{}
+			root[strings.TrimSpace(strings.TrimSuffix(line[1:], "]"))] = table
+			continue
+		}
+
+		i := strings.IndexByte(line, '=')
+		if i <= 0 {
+			return nil, errorf("expected key = value")
+		}
+		key := strings.Trim(strings.TrimSpace(line[:i]), `"`)
+		value := strings.TrimSpace(line[i+1:])
+		switch {
+		case strings.HasPrefix(value, `"""`) || strings.HasPrefix(value, "'''"):
+			// Multi-line string.
+			delim := value[:3]
+			text := value[3:]
+			for !strings.Contains(text, delim) {
+				n++
+				if n == len(lines) {
+					return nil, errorf("unterminated string")
+				}
+				text += "\n" + lines[n]
+			}
+			text = strings.TrimPrefix(text[:strings.Index(text, delim)], "\n")
+			if delim == `"""` {
+				text = tomlUnescaper.Replace(text)
+			}
+			table[key] = text
+			continue
+		case strings.HasPrefix(value, "["):
+			// Arrays may span several lines.
+			for strings.Count(value, "[") > strings.Count(value, "]") {
+				n++
+				if n == len(lines) {
+					return nil, errorf("unterminated array")
+				}
+				value += " " + strings.TrimSpace(lines[n])
+			}
+		}
+		v, err := tomlValue(value)
+		if err != nil {
+			return nil, errorf("%v", err)
+		}
+		table[key] = v
+	}
+	return root, nil
+}
+
+var tomlUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n", `\t`, "\t")
+
+// Parse a TOML value on one line. Numbers and dates are kept as strings.
+func tomlValue(text string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, "["):
+		if i := strings.LastIndexByte(text, ']'); i >= 0 {
+			text = text[:i+1]
+		}
+		return flowList(text, tomlValue)
+	case strings.HasPrefix(text, `"`):
+		s, _, err := quotedString(text)
+		return s, err
+	case strings.HasPrefix(text, "'"):
+		end := strings.IndexByte(text[1:], '\'')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string %s", text)
+		}
+		return text[1 : end+1], nil
+	}
+	if i := strings.IndexByte(text, '#'); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// Babel names of BCP 47 languages, indexed by lower-case tag.
+var babelLanguages = map[string]string{
+	"ar":    "arabic",
+	"bg":    "bulgarian",
+	"ca":    "catalan",
+	"cs":    "czech",
+	"da":    "danish",
+	"de":    "ngerman",
+	"de-at": "naustrian",
+	"de-ch": "nswissgerman",
+	"el":    "greek",
+	"en":    "english",
+	"en-au": "australian",
+	"en-ca": "canadian",
+	"en-gb": "british",
+	"en-nz": "newzealand",
+	"en-us": "american",
+	"es":    "spanish",
+	"et":    "estonian",
+	"fi":    "finnish",
+	"fr":    "french",
+	"ga":    "irish",
+	"he":    "hebrew",
+	"hr":    "croatian",
+	"hu":    "magyar",
+	"id":    "bahasa",
+	"is":    "icelandic",
+	"it":    "italian",
+	"lt":    "lithuanian",
+	"lv":    "latvian",
+	"nb":    "norsk",
+	"nl":    "dutch",
+	"nn":    "nynorsk",
+	"no":    "norsk",
+	"pl":    "polish",
+	"pt":    "portuges",
+	"pt-br": "brazilian",
+	"ro":    "romanian",
+	"ru":    "russian",
+	"sk":    "slovak",
+	"sl":    "slovene",
+	"sr":    "serbian",
+	"sv":    "swedish",
+	"tr":    "turkish",
+	"uk":    "ukrainian",
+}
+
+// Return the babel name of a BCP 47 language, trying the language without
+// its region, or the empty string if unknown.
+func babelLanguage(lang string) string {
+	tag := strings.ToLower(strings.ReplaceAll(lang, "_", "-"))
+	if name, ok := babelLanguages[tag]; ok {
+		return name
+	}
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		return babelLanguages[tag[:i]]
+	}
+	return ""
+}
@@ -0,0 +1,124 @@
+package latex
+
+import "strings"
+
+// PageField is what a slot of the running header or footer shows.
+type PageField int
+
+const (
+	FieldNone PageField = iota
+	FieldTitle
+	FieldAuthor
+	FieldDate
+
+	// FieldSection is the mark of the current section, or chapter in classes
+	// with chapters.
+	FieldSection
+
+	// FieldPage is the page number and FieldPageOfTotal the page number out
+	// of the number of pages, e.g. "3 of 12", with the lastpage package.
+	FieldPage
+	FieldPageOfTotal
+
+	FieldLogo
+	FieldClassification
+)
+
+// PageStyle sets up running headers and footers with fancyhdr. The zero value
+// keeps the page style of the class. Page styles do not apply to
+// presentations.
+type PageStyle struct {
+	// Header and Footer are the left, center and right slots of the running
+	// header and footer.
+	Header [3]PageField
+	Footer [3]PageField
+
+	// Logo is the path of the image shown by FieldLogo.
+	Logo string
+
+	// Classification is the label shown by FieldClassification, e.g.
+	// "Confidential".
+	Classification string
+}
+
+// TemplatePageStyle is the page style as passed to the templates.
+type TemplatePageStyle struct {
+	// Header and Footer are the slots that show something.
+	Header []PageSlot
+	Footer []PageSlot
+
+	// LastPage is true when the lastpage package is needed.
+	LastPage bool
+
+	// HeadHeight is the height of the header, when the logo needs more room
+	// than the default.
+	HeadHeight string
+}
+
+// PageSlot is a slot of the running header or footer.
+type PageSlot struct {
+	// Position is the fancyhdr position of the slot: L, C or R.
+	Position string
+
+	// Text is the LaTeX content of the slot.
+	Text string
+}
+
+var slotPositions = [3]string{"L", "C", "R"}
+
+// Return the page style for the templates, or nil if there is none. The
+// title, author and date are those of the title page.
+func (r *Renderer) pageStyle(data *TemplateData) *TemplatePageStyle {
+	if r.PageStyle.Header == [3]PageField{} && r.PageStyle.Footer == [3]PageField{} || data.Beamer() {
+		return nil
+	}
+	var style TemplatePageStyle
+	slots := func(fields [3]PageField, header bool) []PageSlot {
+		var slots []PageSlot
+		for i, f := range fields {
+			var text string
+			switch f {
+			case FieldTitle:
+				text = strings.ReplaceAll(data.Title, `\\`+"\n", " ")
+			case FieldAuthor:
+				text = strings.Join(pageAuthors(data.Authors), ", ")
+			case FieldDate:
+				text = data.Date
+			case FieldSection:
+				text = `\leftmark`
+			case FieldPage:
+				text = `\thepage`
+			case FieldPageOfTotal:
+				text = `\thepage{} of \pageref{LastPage}`
+				style.LastPage = true
+			case FieldLogo:
+				if r.PageStyle.Logo != "" {
+					text = `\includegraphics[height=\headheight]{` + r.graphicsPath(r.PageStyle.Logo) + `}`
+					if header {
+						style.HeadHeight = "24pt"
+					}
+				}
+			case FieldClassification:
+				if r.PageStyle.Classification != "" {
+					text = `\textbf{` + r.escapeMeta(r.PageStyle.Classification) + `}`
+				}
+			}
+			if text != "" {
+				slots = append(slots, PageSlot{Position: slotPositions[i], Text: text})
+			}
+		}
+		return slots
+	}
+	style.Header = slots(r.PageStyle.Header, true)
+	style.Footer = slots(r.PageStyle.Footer, false)
+	return &style
+}
+
+// Return the names of the authors.
+func pageAuthors(authors []TemplateAuthor) []string {
+	var names []string
+	for _, a := range authors {
+		names = append(names, a.Name)
+	}
+	return names
+}
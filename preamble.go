@@ -0,0 +1,249 @@
+package latex
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// Preamble holds additions to the preamble and to the document. They are
+// added to those of the metadata.
+type Preamble struct {
+	// Packages are loaded at the end of the preamble, before hyperref, unless
+	// the preamble already loads them. Their options override those of the
+	// preamble. The packages the preamble loads are read from the output of
+	// the "header" template, which may be a custom one: it receives the
+	// packages to load and their options in TemplateData.
+	Packages []Package
+
+	// Macros are defined after the packages.
+	Macros []Macro
+
+	// HeaderIncludes are raw LaTeX lines added at the end of the preamble.
+	// Lines that only load packages are handled as Packages.
+	HeaderIncludes []string
+
+	// IncludeBefore and IncludeAfter are raw LaTeX lines added right after
+	// `\begin{document}` and right before `\end{document}`.
+	IncludeBefore []string
+	IncludeAfter  []string
+}
+
+// Package is a LaTeX package, with its options, e.g. "margin=2cm".
+type Package struct {
+	Name    string
+	Options []string
+}
+
+// Macro is a command defined with `\newcommand`. Name is given with or without
+// the backslash; Args is the number of arguments, counted from the `#n` of the
+// definition when 0.
+type Macro struct {
+	Name       string
+	Args       int
+	Definition string
+}
+
+// TemplatePackage is a package as passed to the templates, with its options
+// separated by commas.
+type TemplatePackage struct {
+	Name    string
+	Options string
+}
+
+var (
+	// A line that only loads packages.
+	usepackageLine = regexp.MustCompile(`^\s*\\usepackage\s*(?:\[([^\]]*)\])?\s*\{([^}]*)\}\s*$`)
+
+	// A package load anywhere in the preamble.
+	usepackage = regexp.MustCompile(`\\(?:usepackage|RequirePackage)\s*(?:\[([^\]]*)\])?\s*\{([^}]*)\}`)
+
+	macroArg = regexp.MustCompile(`#([1-9])`)
+)
+
+// Return the packages of a `\usepackage` match: the options and names.
+func matchPackages(m []string) []Package {
+	var packages []Package
+	options := splitOptions(m[1])
+	for _, name := range strings.Split(m[2], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			packages = append(packages, Package{Name: name, Options: options})
+		}
+	}
+	return packages
+}
+
+// Split comma-separated options. Options are trimmed and empty ones dropped.
+func splitOptions(s string) []string {
+	var options []string
+	for _, o := range strings.Split(s, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			options = append(options, o)
+		}
+	}
+	return options
+}
+
+// Return the key of an option, e.g. "margin" for "margin=2cm", or "" if the
+// option has no value.
+func optionKey(o string) string {
+	if i := strings.IndexByte(o, '='); i >= 0 {
+		return strings.TrimSpace(o[:i])
+	}
+	return ""
+}
+
+// Return the header includes with the lines that only load packages taken out,
+// and those packages.
+func splitHeaderIncludes(includes []string) ([]string, []Package) {
+	var rest []string
+	var packages []Package
+	for _, include := range includes {
+		var lines []string
+		for _, line := range strings.Split(include, "\n") {
+			if m := usepackageLine.FindStringSubmatch(line); m != nil {
+				packages = append(packages, matchPackages(m)...)
+			} else {
+				lines = append(lines, line)
+			}
+		}
+		if text := strings.Join(lines, "\n"); strings.TrimSpace(text) != "" {
+			rest = append(rest, text)
+		}
+	}
+	return rest, packages
+}
+
+// Merge options into a list of options. An option that gives a key of the
+// list another value replaces it; the options replaced are returned too.
+func mergeOptions(list, options []string) (merged, replaced []string) {
+	merged = append([]string(nil), list...)
+	for _, o := range options {
+		if key := optionKey(o); key != "" {
+			kept := merged[:0]
+			for _, prev := range merged {
+				if optionKey(prev) == key && prev != o {
+					replaced = append(replaced, prev)
+				} else {
+					kept = append(kept, prev)
+				}
+			}
+			merged = kept
+		}
+		merged = appendOptions(merged, o)
+	}
+	return merged, replaced
+}
+
+// Packages that other packages load, e.g. adjustbox with the export option.
+var impliedPackages = map[string][]string{
+	"adjustbox": {"graphicx"},
+}
+
+// Return the packages the header template loads by itself, with their
+// options, as found in its output. Custom templates are thus handled like the
+// default one.
+func (r *Renderer) templatePackages(data *TemplateData) map[string][]string {
+	var w bytes.Buffer
+	r.execute(&w, "header", data)
+	preamble := w.String()
+	if i := strings.Index(preamble, `\begin{document}`); i >= 0 {
+		preamble = preamble[:i]
+	}
+	loaded := map[string][]string{}
+	for _, m := range usepackage.FindAllStringSubmatch(preamble, -1) {
+		for _, p := range matchPackages(m) {
+			loaded[p.Name] = p.Options
+			for _, name := range impliedPackages[p.Name] {
+				if _, ok := loaded[name]; !ok {
+					loaded[name] = nil
+				}
+			}
+		}
+	}
+	return loaded
+}
+
+// Options returns the options of a package the preamble loads with the given
+// options: those options, overridden by the ones added to the preamble.
+func (d *TemplateData) Options(pkg, options string) string {
+	merged, _ := mergeOptions(splitOptions(options), d.options[pkg])
+	return strings.Join(merged, ",")
+}
+
+// Set up the packages added to the preamble. They are merged, a later option
+// overriding an earlier one with another value. The options of the packages
+// the preamble loads with options of its own override those; other options
+// are passed before the document class, so that they reach the package
+// wherever it is loaded. The packages the preamble does not load are loaded
+// at its end.
+func (r *Renderer) preamblePackages(data *TemplateData) {
+	var includes []Package
+	data.HeaderIncludes, includes = splitHeaderIncludes(data.HeaderIncludes)
+	var requested []Package
+	requested = append(requested, r.Metadata.Packages...)
+	requested = append(requested, r.Preamble.Packages...)
+	requested = append(requested, includes...)
+	if len(requested) == 0 {
+		return
+	}
+
+	// The packages loaded by the template, including those of the remaining
+	// header includes.
+	loaded := r.templatePackages(data)
+
+	var names []string
+	merged := map[string][]string{}
+	for _, p := range requested {
+		if _, ok := merged[p.Name]; !ok {
+			names = append(names, p.Name)
+		}
+		var replaced []string
+		merged[p.Name], replaced = mergeOptions(merged[p.Name], p.Options)
+		for _, o := range replaced {
+			r.warn("package %s: option %q overridden", p.Name, o)
+		}
+	}
+	for _, name := range names {
+		builtin, ok := loaded[name]
+		options := merged[name]
+		switch {
+		case len(options) == 0:
+		case len(builtin) != 0:
+			if data.options == nil {
+				data.options = map[string][]string{}
+			}
+			data.options[name] = options
+		default:
+			data.PackageOptions = append(data.PackageOptions, TemplatePackage{Name: name, Options: strings.Join(options, ",")})
+		}
+		if !ok {
+			data.Packages = append(data.Packages, TemplatePackage{Name: name})
+		}
+	}
+}
+
+// Return the macros of the metadata and of the renderer. A macro defined twice
+// is reported and the last definition is kept.
+func (r *Renderer) macros() []Macro {
+	var macros []Macro
+	index := map[string]int{}
+	for _, m := range append(append([]Macro(nil), r.Metadata.Macros...), r.Preamble.Macros...) {
+		m.Name = strings.TrimPrefix(m.Name, `\`)
+		if m.Args == 0 {
+			for _, a := range macroArg.FindAllStringSubmatch(m.Definition, -1) {
+				if n := int(a[1][0] - '0'); n > m.Args {
+					m.Args = n
+				}
+			}
+		}
+		if i, ok := index[m.Name]; ok {
+			r.warn(`macro \%s defined twice`, m.Name)
+			macros[i] = m
+			continue
+		}
+		index[m.Name] = len(macros)
+		macros = append(macros, m)
+	}
+	return macros
+}
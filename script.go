@@ -0,0 +1,161 @@
+package latex
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// The writing systems the Multilingual flag handles.
+type script int
+
+const (
+	scriptLatin   script = iota // Latin, and any script typeset as is.
+	scriptNeutral               // Spaces, digits and punctuation.
+	scriptCJK
+	scriptHebrew
+	scriptArabic
+)
+
+func scriptOf(c rune) script {
+	switch {
+	case unicode.In(c, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul),
+		c >= 0x3000 && c <= 0x303F, // CJK punctuation.
+		c >= 0xFF00 && c <= 0xFFEF: // Full-width forms.
+		return scriptCJK
+	case unicode.Is(unicode.Hebrew, c):
+		return scriptHebrew
+	case unicode.Is(unicode.Arabic, c):
+		return scriptArabic
+	case unicode.IsSpace(c), unicode.IsDigit(c), unicode.IsPunct(c), unicode.IsSymbol(c):
+		return scriptNeutral
+	}
+	return scriptLatin
+}
+
+// Return the font of the CJK package for a run: Japanese if it has kana, Korean
+// if it has Hangul, Chinese otherwise.
+func cjkFont(run []byte) string {
+	font := "gbsn"
+	for _, c := range string(run) {
+		switch {
+		case unicode.In(c, unicode.Hiragana, unicode.Katakana):
+			return "min"
+		case unicode.Is(unicode.Hangul, c):
+			font = "mj"
+		}
+	}
+	return font
+}
+
+// Split text into runs of the same script. Neutral characters between two
+// characters of a script belong to the run; the others belong to Latin runs.
+func scriptRuns(text []byte, yield func(s script, run []byte)) {
+	org, current := 0, scriptLatin
+	end := 0 // End of the last character of the current script.
+	for i := 0; i < len(text); {
+		c, size := utf8.DecodeRune(text[i:])
+		s := scriptOf(c)
+		switch {
+		case s == scriptNeutral:
+		case s == current:
+			end = i + size
+		default:
+			if current != scriptLatin {
+				// Trailing neutral characters go back to Latin text.
+				yield(current, text[org:end])
+				org = end
+			}
+			if s != scriptLatin {
+				yield(scriptLatin, text[org:i])
+				org = i
+			}
+			current, end = s, i+size
+		}
+		i += size
+	}
+	if current != scriptLatin {
+		yield(current, text[org:end])
+		org = end
+	}
+	yield(scriptLatin, text[org:])
+}
+
+// Write escaped text, with the runs of CJK and right-to-left scripts wrapped
+// in the commands the engine needs. XeLaTeX and LuaLaTeX switch CJK fonts
+// themselves; pdfLaTeX needs the CJK environment. Right-to-left text is set
+// with polyglossia, which pdfLaTeX cannot use: there, it is set without bidi
+// support and reported by Warnings.
+func (r *Renderer) multilingual(text []byte) {
+	scriptRuns(text, func(s script, run []byte) {
+		if len(run) == 0 {
+			return
+		}
+		switch {
+		case s == scriptCJK && !r.Engine.unicode():
+			r.w.WriteString(`\begin{CJK}{UTF8}{` + cjkFont(run) + `}`)
+			escapeText(&r.w, run, &r.quoted)
+			r.w.WriteString(`\end{CJK}`)
+		case s == scriptHebrew && r.Engine.unicode():
+			r.w.WriteString(`\texthebrew{`)
+			r.escText(run)
+			r.w.WriteByte('}')
+		case s == scriptArabic && r.Engine.unicode():
+			r.w.WriteString(`\textarabic{`)
+			r.escText(run)
+			r.w.WriteByte('}')
+		case s == scriptHebrew || s == scriptArabic:
+			if !r.rtlWarned {
+				r.rtlWarned = true
+				r.warn("right-to-left text needs XeLaTeX or LuaLaTeX")
+			}
+			r.escText(run)
+		default:
+			r.escText(run)
+		}
+	})
+}
+
+// Return the scripts that need packages of the document text and of other
+// texts, such as the title of the metadata.
+func documentScripts(ast *bf.Node, texts ...string) (cjk, hebrew, arabic bool) {
+	scan := func(text string) {
+		for _, c := range text {
+			switch scriptOf(c) {
+			case scriptCJK:
+				cjk = true
+			case scriptHebrew:
+				hebrew = true
+			case scriptArabic:
+				arabic = true
+			}
+		}
+	}
+	ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		if node.Type == bf.Text {
+			scan(string(node.Literal))
+		}
+		return bf.GoToNext
+	})
+	for _, text := range texts {
+		scan(text)
+	}
+	return
+}
+
+// Return the titles and names of the renderer and of the metadata, which are
+// rendered with the script commands of the body.
+func (r *Renderer) metaNames() []string {
+	names := []string{r.Title, r.Author, r.Metadata.Title, r.Metadata.Subtitle}
+	for _, a := range append(append([]Author(nil), r.Authors...), r.Metadata.Authors...) {
+		names = append(names, a.Name, a.Affiliation)
+	}
+	return names
+}
+
+// Report whether text is only ASCII.
+func isASCII(text []byte) bool {
+	return bytes.IndexFunc(text, func(c rune) bool { return c >= utf8.RuneSelf }) < 0
+}
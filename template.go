@@ -0,0 +1,814 @@
+package latex
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"text/template"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// Template delimiters. LaTeX makes heavy use of braces, so the usual `{{` and
+// `}}` delimiters of text/template would clash with the preamble content.
+const (
+	LeftDelim  = "<<"
+	RightDelim = ">>"
+)
+
+// TemplateData is the data the templates are executed with.
+type TemplateData struct {
+	// Title is the document title, already rendered to LaTeX.
+	Title string
+
+	// Author is the document author as set on the renderer, escaped, or the
+	// authors of the metadata or of the title block separated by `\and`.
+	Author string
+
+	// Authors are the document authors and Affiliations their affiliations.
+	// They are set up with authblk, or with `\institute` in presentations,
+	// when there are affiliations.
+	Authors      []TemplateAuthor
+	Affiliations []Affiliation
+
+	// PDFAuthor are the comma-separated author names for the PDF metadata.
+	PDFAuthor string
+
+	// Subtitle is the escaped subtitle of the metadata.
+	Subtitle string
+
+	// Date is the document date, empty for that of the day LaTeX prints by
+	// default.
+	Date string
+
+	// Keywords are the escaped, comma-separated keywords of the metadata or
+	// of the keywords section.
+	Keywords string
+
+	// Abstract, Dedication and Epigraph are rendered from the metadata or
+	// from the sections marked with these classes, e.g. `# Abstract
+	// {.abstract}`. EpigraphSource is the escaped source of the epigraph.
+	Abstract       string
+	Dedication     string
+	Epigraph       string
+	EpigraphSource string
+
+	// Geometry are the options of the geometry package.
+	Geometry string
+
+	// LineSpacing is the line spacing factor, empty for single spacing.
+	LineSpacing string
+
+	// PackageOptions are the options passed to packages before the document
+	// class. Packages are the packages loaded at the end of the preamble,
+	// before hyperref, and Macros the macros defined after them.
+	PackageOptions []TemplatePackage
+	Packages       []TemplatePackage
+	Macros         []Macro
+
+	// The options added to the packages the preamble loads with options,
+	// which override them.
+	options map[string][]string
+
+	// HeaderIncludes are raw LaTeX lines added at the end of the preamble.
+	// IncludeBefore and IncludeAfter are added right after
+	// `\begin{document}` and right before `\end{document}`.
+	HeaderIncludes []string
+	IncludeBefore  []string
+	IncludeAfter   []string
+
+	// Bibliography are the BibTeX files of the citations, for biblatex.
+	Bibliography []string
+
+	// Class is the document class and ClassOptions its comma-separated options.
+	Class        DocumentClass
+	ClassOptions string
+
+	// ChapterCommand is the sectioning command used by the "chapter" template.
+	ChapterCommand string
+
+	// CodeEngine is how code is typeset.
+	CodeEngine CodeEngine
+
+	// LanguageDefinitions define the code languages listings lacks.
+	LanguageDefinitions []string
+
+	// Languages are the comma-separated languages passed to `babel`.
+	Languages string
+
+	// Engine is the TeX engine. With Unicode engines, the fonts are set by
+	// MainFont, SansFont and MonoFont when not empty.
+	Engine   Engine
+	MainFont string
+	SansFont string
+	MonoFont string
+
+	// CJKFont, HebrewFont and ArabicFont are the fonts of these scripts with
+	// Unicode engines, when not empty.
+	CJKFont    string
+	HebrewFont string
+	ArabicFont string
+
+	// UnicodePackages are the packages needed by the characters of the
+	// document, such as amssymb or pifont.
+	UnicodePackages []string
+
+	// CodeCharacters are the non-ASCII characters of the code that pdfLaTeX
+	// needs help with.
+	CodeCharacters []CodeCharacter
+
+	// Flags are the renderer flags.
+	Flags Flag
+
+	// Theme is the look of the document.
+	Theme *Theme
+
+	// PageStyle is the running header and footer, nil for the page style of
+	// the class.
+	PageStyle *TemplatePageStyle
+
+	// Draft is the watermark, draft line, banner and line numbering of a
+	// draft, nil for the final document.
+	Draft *TemplateDraft
+
+	// TOCDepth and SecNumDepth are the values of the tocdepth and secnumdepth
+	// counters, empty to keep those of the class.
+	TOCDepth    string
+	SecNumDepth string
+
+	// Version is the version of the Blackfriday processor.
+	Version string
+
+	// Features records what the document makes use of.
+	Features Features
+}
+
+// Features records which constructs are found in a document.
+type Features struct {
+	// Figures is true when the document has images with a title.
+	Figures bool
+
+	// Tables and Listings are true when the document has tables and code
+	// blocks with a caption.
+	Tables   bool
+	Listings bool
+
+	// CJK, Hebrew and Arabic are true when the text has characters of these
+	// scripts and the Multilingual flag is on.
+	CJK    bool
+	Hebrew bool
+	Arabic bool
+
+	// Code, Math, Images, Links, Quotes, Strikethrough, Rules and Euro are
+	// true when the document has code, math, local images, links (including
+	// cross references and URLs), double quotes, strikethrough text,
+	// horizontal rules and euro signs. With the MinimalPreamble flag, only
+	// the packages of these constructs are loaded.
+	Code          bool
+	Math          bool
+	Images        bool
+	Links         bool
+	Quotes        bool
+	Strikethrough bool
+	Rules         bool
+	Euro          bool
+}
+
+// Needs reports whether the preamble loads a package, which is always the case
+// unless the MinimalPreamble flag is on. The "code" package stands for that of
+// the code engine, and "HRule" for the command of horizontal rules. xcolor is
+// only loaded when colors are used: by the theme, the styling of listings, the
+// highlighting, or link colors beyond those of the color package.
+func (d *TemplateData) Needs(pkg string) bool {
+	if pkg == "xcolor" {
+		t := d.Theme
+		if len(t.Colors) != 0 || t.HeadingColor != "" || d.Needs("code") && (d.Listings() || d.Highlight()) {
+			return true
+		}
+		return d.Needs("hyperref") && !(basicColor(t.LinkColor) && basicColor(t.CiteColor) && basicColor(t.URLColor))
+	}
+	if d.Flags&MinimalPreamble == 0 {
+		return true
+	}
+	f := d.Features
+	switch pkg {
+	case "marvosym":
+		return f.Euro
+	case "amsmath", "unicode-math":
+		return f.Math
+	case "adjustbox":
+		return f.Images
+	case "code":
+		return f.Code
+	case "verbatim":
+		return false
+	case "ulem":
+		return f.Strikethrough
+	case "hyperref":
+		return f.Links
+	case "csquotes":
+		return f.Quotes
+	case "HRule":
+		return f.Rules
+	}
+	return true
+}
+
+// Report whether a color is defined by the color package, which hyperref
+// loads.
+func basicColor(c string) bool {
+	switch c {
+	case "", "black", "white", "red", "green", "blue", "cyan", "magenta", "yellow":
+		return true
+	}
+	return false
+}
+
+// TOC reports whether the table of contents is requested.
+func (d *TemplateData) TOC() bool {
+	return d.Flags&TOC != 0
+}
+
+// Beamer reports whether the document is a beamer presentation.
+func (d *TemplateData) Beamer() bool {
+	return d.Class == ClassBeamer
+}
+
+// Chapters reports whether the document class has chapters.
+func (d *TemplateData) Chapters() bool {
+	return classProfiles[d.Class].chapters()
+}
+
+// KOMA reports whether the document class is from KOMA-Script.
+func (d *TemplateData) KOMA() bool {
+	return classProfiles[d.Class].koma
+}
+
+// Listings reports whether code is typeset with the listings package.
+func (d *TemplateData) Listings() bool {
+	return d.CodeEngine == CodeListings
+}
+
+// Minted reports whether code is typeset with the minted package.
+func (d *TemplateData) Minted() bool {
+	return d.CodeEngine == CodeMinted
+}
+
+// Fancyvrb reports whether code is typeset with the fancyvrb package, with or
+// without highlighting.
+func (d *TemplateData) Fancyvrb() bool {
+	return d.CodeEngine == CodeVerbatim || d.CodeEngine == CodeHighlight
+}
+
+// Highlight reports whether code is highlighted by the renderer.
+func (d *TemplateData) Highlight() bool {
+	return d.CodeEngine == CodeHighlight
+}
+
+// UnicodeEngine reports whether the engine is XeLaTeX or LuaLaTeX.
+func (d *TemplateData) UnicodeEngine() bool {
+	return d.Engine.unicode()
+}
+
+// Authblk reports whether the authors are set up with the authblk package.
+func (d *TemplateData) Authblk() bool {
+	return len(d.Affiliations) != 0 && !d.Beamer()
+}
+
+// NativeAbstract reports whether the class has an abstract environment.
+func (d *TemplateData) NativeAbstract() bool {
+	return d.Class != ClassBook && d.Class != ClassKOMABook
+}
+
+// NativeEpigraph reports whether the class has an `\epigraph` command.
+func (d *TemplateData) NativeEpigraph() bool {
+	return d.Class == ClassMemoir
+}
+
+// NativeSubtitle reports whether the class has a `\subtitle` command.
+func (d *TemplateData) NativeSubtitle() bool {
+	return d.KOMA() || d.Beamer()
+}
+
+// LuaLaTeX reports whether the engine is LuaLaTeX.
+func (d *TemplateData) LuaLaTeX() bool {
+	return d.Engine == EngineLuaLaTeX
+}
+
+// Polyglossia returns the languages to be set up with polyglossia, the main
+// language first. Hebrew and Arabic are added when the text has them.
+func (d *TemplateData) Polyglossia() []PolyglossiaLanguage {
+	languages := polyglossia(d.Languages)
+	if d.Features.Hebrew {
+		languages = addLanguage(languages, "hebrew")
+	}
+	if d.Features.Arabic {
+		languages = addLanguage(languages, "arabic")
+	}
+	return languages
+}
+
+// TitlePageStyle returns the page style of the title and dedication pages:
+// empty, or plain to keep the footer of the running page style.
+func (d *TemplateData) TitlePageStyle() string {
+	if d.PageStyle != nil {
+		return "plain"
+	}
+	return "empty"
+}
+
+// HeadingStyle returns the font commands of the headings of the theme.
+func (d *TemplateData) HeadingStyle() string {
+	style := d.Theme.HeadingFont
+	if d.Theme.HeadingColor != "" {
+		style += `\color{` + d.Theme.HeadingColor + `}`
+	}
+	return style
+}
+
+// Titlesec reports whether the headings are styled with titlesec, which
+// KOMA-Script, memoir and beamer do not need.
+func (d *TemplateData) Titlesec() bool {
+	return d.HeadingStyle() != "" && !d.KOMA() && !d.Beamer() && d.Class != ClassMemoir
+}
+
+// NoParIndent reports whether paragraph indentation is disabled.
+func (d *TemplateData) NoParIndent() bool {
+	return d.Flags&NoParIndent != 0
+}
+
+// The default templates. The entry points are "header", "chapter" and
+// "footer"; "header" is made of "preamble", "author", "title", "front" and
+// "toc". With XeLaTeX and LuaLaTeX, "preamble" loads the fonts with "fonts".
+const defaultTemplateText = `<<define "header">><<template "preamble" .>>
+<<- if .Title>>
+\title{<<.Title>><<if and .Subtitle (not .NativeSubtitle)>>\\
+\large <<.Subtitle>><<end>>}
+<<if and .Subtitle .NativeSubtitle>>\subtitle{<<.Subtitle>>}
+<<end>><<template "author" .>><<with .Date>>\date{<<.>>}
+<<end>><<end>>
+\begin{document}
+<<range .IncludeBefore>><<.>>
+<<end>><<template "title" .>><<template "front" .>><<template "toc" .>>
+
+<<end>>
+
+<<- define "preamble">><<range .PackageOptions>>\PassOptionsToPackage{<<.Options>>}{<<.Name>>}
+<<end>>\documentclass<<with .ClassOptions>>[<<.>>]<<end>>{<<.Class>>}
+
+<<if .UnicodeEngine>><<template "fonts" .>>
+<<- else>>\usepackage[<<.Options "inputenc" "utf8">>]{inputenc}
+\usepackage[<<.Options "fontenc" "T1">>]{fontenc}
+\usepackage{lmodern}
+<<range .Theme.FontPackages>>\usepackage{<<.>>}
+<<end ->>
+<<if .Needs "marvosym">>\usepackage{marvosym}
+<<end>>\usepackage{textcomp}
+<<range .UnicodePackages>>\usepackage{<<.>>}
+<<end ->>
+<<if .Features.CJK>>\usepackage{CJKutf8}
+<<end ->>
+<<if .Needs "marvosym">>\DeclareUnicodeCharacter{20AC}{\EUR{}}
+<<end>>\DeclareUnicodeCharacter{2260}{\neq}
+\DeclareUnicodeCharacter{2264}{\leq}
+\DeclareUnicodeCharacter{2265}{\geq}
+\DeclareUnicodeCharacter{22C5}{\cdot}
+\DeclareUnicodeCharacter{A0}{~}
+\DeclareUnicodeCharacter{B1}{\pm}
+\DeclareUnicodeCharacter{D7}{\times}
+<<if not .Listings>><<range .CodeCharacters>><<if not .Native>>\DeclareUnicodeCharacter{<<.Code>>}{<<.Command>>}
+<<end>><<end>><<end>><<end>>
+<<if .Theme.SansSerif>>\renewcommand{\familydefault}{\sfdefault}
+<<end ->>
+<<if .Needs "amsmath">>\usepackage{amsmath}
+<<end>><<if and .UnicodeEngine (.Needs "unicode-math")>>\usepackage{unicode-math}
+<<end ->>
+<<if .Needs "adjustbox">>\usepackage[<<.Options "adjustbox" "export">>]{adjustbox} % loads also graphicx
+<<end>><<if not (.Needs "code")>><<else if .Listings>>\usepackage{listings}
+<<else if .Minted>>\usepackage{minted}
+<<else>>\usepackage{fancyvrb}
+<<end>><<if not .Beamer>>\usepackage[<<.Options "geometry" .Geometry>>]{geometry}
+<<end>><<with .LineSpacing>>\usepackage{setspace}
+\setstretch{<<.>>}
+<<end>><<if .Needs "verbatim">>\usepackage{verbatim}
+<<end>><<if .Needs "ulem">>\usepackage[<<.Options "ulem" "normalem">>]{ulem}
+<<end>><<if .Needs "xcolor">>\usepackage{xcolor}
+<<end>><<range $name, $value := .Theme.Colors>>\definecolor{<<$name>>}{HTML}{<<$value>>}
+<<end>><<if .Needs "code">>
+<<template "code" .>><<end>>
+<<- if .UnicodeEngine>><<with .Polyglossia>>
+\usepackage{polyglossia}
+<<range .>>\set<<if .Default>>default<<else>>other<<end>>language<<with .Options>>[<<.>>]<<end>>{<<.Name>>}
+<<end>><<end>>
+<<- if .Features.Hebrew>><<with .HebrewFont>>\newfontfamily\hebrewfont[Script=Hebrew]{<<.>>}
+<<end>><<end>>
+<<- if .Features.Arabic>><<with .ArabicFont>>\newfontfamily\arabicfont[Script=Arabic]{<<.>>}
+<<end>><<end>>
+<<- else if .Languages>>
+\usepackage[<<.Options "babel" .Languages>>]{babel}
+<<end ->>
+<<if .Needs "csquotes">>\usepackage{csquotes}
+<<end>><<if and .Epigraph (not .NativeEpigraph)>>\usepackage{epigraph}
+<<end>><<if .Authblk>>\usepackage{authblk}
+<<end>><<if .Bibliography>>\usepackage{biblatex}
+<<range .Bibliography>>\addbibresource{<<.>>}
+<<end>><<end>>
+<<if .Needs "HRule">>\newcommand{\HRule}{\rule{\linewidth}{0.5mm}}
+<<end>><<if not (or .Beamer .KOMA)>>\addtolength{\parskip}{0.5\baselineskip}
+<<end>><<if .NoParIndent>>\parindent=0pt
+<<end>><<with .PageStyle>>\usepackage{fancyhdr}
+<<if .LastPage>>\usepackage{lastpage}
+<<end>>\pagestyle{fancy}
+\fancyhf{}
+<<range .Header>>\fancyhead[<<.Position>>]{<<.Text>>}
+<<end>><<range .Footer>>\fancyfoot[<<.Position>>]{<<.Text>>}
+<<end>><<with .HeadHeight>>\setlength{\headheight}{<<.>>}
+<<end>>\fancypagestyle{plain}{\fancyhead{}\renewcommand{\headrulewidth}{0pt}}
+<<end>><<with .Draft>><<with .Watermark>>\usepackage{draftwatermark}
+\SetWatermarkText{<<.>>}
+\SetWatermarkScale{1}
+<<end>><<if or .Footer .Banner>>\usepackage{eso-pic}
+<<end>><<with .Footer>>\AddToShipoutPictureFG{\AtPageLowerLeft{\makebox[\paperwidth]{\raisebox{1.5em}{\footnotesize <<.>>}}}}
+<<end>><<with .Banner>>\AddToShipoutPictureFG{\AtPageUpperLeft{\makebox[\paperwidth]{\raisebox{-2em}{\textbf{<<.>>}}}}}
+<<end>><<if .LineNumbers>>\usepackage{lineno}
+\linenumbers
+<<end>><<end>><<with .TOCDepth>>\setcounter{tocdepth}{<<.>>}
+<<end>><<with .SecNumDepth>>\setcounter{secnumdepth}{<<.>>}
+<<end>>
+<<- with .HeadingStyle>><<if $.KOMA>>\addtokomafont{disposition}{<<.>>}
+<<else if $.Titlesec>>\usepackage{titlesec}
+<<if $.Chapters>>\titleformat{\chapter}[display]{\normalfont\huge\bfseries<<.>>}{\chaptertitlename\ \thechapter}{20pt}{\Huge}
+<<end>>\titleformat*{\section}{\Large\bfseries<<.>>}
+\titleformat*{\subsection}{\large\bfseries<<.>>}
+\titleformat*{\subsubsection}{\normalsize\bfseries<<.>>}
+<<end>><<end>>
+<<- if and .Abstract (not .NativeAbstract)>>\providecommand{\abstractname}{Abstract}
+\newenvironment{abstract}{\chapter*{\abstractname}}{}
+<<end>>
+<<- range .Packages>>\usepackage{<<.Name>>}
+<<end>>
+<<- if .Needs "hyperref">>\usepackage{hyperref}
+\hypersetup{colorlinks,
+	citecolor=<<.Theme.CiteColor>>,
+	filecolor=<<.Theme.LinkColor>>,
+	linkcolor=<<.Theme.LinkColor>>,
+	linktoc=page,
+	urlcolor=<<.Theme.URLColor>>,
+	pdfstartview=FitH,
+	breaklinks=true,
+	pdfcreator={Blackfriday Markdown Processor v<<.Version>>},
+<<- with .PDFAuthor>>
+	pdfauthor={<<.>>},
+<<- end>>
+<<- with .Keywords>>
+	pdfkeywords={<<.>>},
+<<- end>>
+}
+<<end>>
+<<- range .Macros>>\newcommand{\<<.Name>>}<<with .Args>>[<<.>>]<<end>>{<<.Definition>>}
+<<end>>
+<<- range .HeaderIncludes>><<.>>
+<<end>>
+<<- end>>
+
+<<- define "author">><<if .Authblk>><<range .Authors>>\author<<with .Affiliation>>[<<.>>]<<end>>{<<.Name>><<with .Thanks>>\thanks{<<.>>}<<end>>}
+<<end>><<range .Affiliations>>\affil[<<.Number>>]{<<.Name>>}
+<<end>><<else if .Beamer>>\author{<<range $i, $a := .Authors>><<if $i>> \and <<end>><<.Name>><<with .Affiliation>>\inst{<<.>>}<<end>><<with .Thanks>>\thanks{<<.>>}<<end>><<end>>}
+<<with .Affiliations>>\institute{<<range $i, $a := .>><<if $i>> \and <<end>>\inst{<<.Number>>}<<.Name>><<end>>}
+<<end>><<else>>\author{<<.Author>>}
+<<end>><<end>>
+
+<<- define "fonts">>\usepackage{fontspec}
+<<with .MainFont>>\setmainfont{<<.>>}
+<<end>><<with .SansFont>>\setsansfont{<<.>>}
+<<end>><<with .MonoFont>>\setmonofont{<<.>>}
+<<end>><<if .Features.CJK>><<if .LuaLaTeX>>\usepackage{luatexja-fontspec}
+<<with .CJKFont>>\setmainjfont{<<.>>}
+<<end>><<else>>\usepackage{xeCJK}
+<<with .CJKFont>>\setCJKmainfont{<<.>>}
+<<end>><<end>><<end>>\usepackage{textcomp}
+<<end>>
+
+<<- define "code">><<if .Listings>><<template "lstset" .>>
+<<- range .LanguageDefinitions>><<.>>
+<<end>>
+<<- else if .Minted>>\setminted{
+<<- if .Theme.LineNumbers>>
+	linenos,
+<<- end>>
+	breaklines=true,
+	xleftmargin=2\baselineskip,
+<<- with .Theme.MintedStyle>>
+	style=<<.>>,
+<<- end>>
+}
+<<else>>\fvset{
+<<- if .Theme.LineNumbers>>
+	numbers=left,
+<<- end>>
+	xleftmargin=2\baselineskip,
+}
+<<if .Highlight>>\colorlet{CodeKeyword}{<<.Theme.Keyword>>}
+\colorlet{CodeComment}{<<.Theme.Comment>>}
+\colorlet{CodeString}{<<.Theme.String>>}
+\colorlet{CodeNumber}{<<.Theme.Number>>}
+<<end>><<end>><<end>>
+
+<<- define "lstset">>\lstset{
+<<- if .Theme.LineNumbers>>
+	numbers=left,
+<<- end>>
+	breaklines=true,
+	xleftmargin=2\baselineskip,
+	showstringspaces=false,
+	basicstyle=\ttfamily,
+	keywordstyle=\bfseries\color{<<.Theme.Keyword>>},
+	commentstyle=\itshape\color{<<.Theme.Comment>>},
+	stringstyle=\color{<<.Theme.String>>},
+	numberstyle=\ttfamily,
+<<- if not .UnicodeEngine>>
+	literate=
+	{á}{{\'a}}1 {é}{{\'e}}1 {í}{{\'i}}1 {ó}{{\'o}}1 {ú}{{\'u}}1
+	{Á}{{\'A}}1 {É}{{\'E}}1 {Í}{{\'I}}1 {Ó}{{\'O}}1 {Ú}{{\'U}}1
+	{à}{{\` + "`" + `a}}1 {è}{{\` + "`" + `e}}1 {ì}{{\` + "`" + `i}}1 {ò}{{\` + "`" + `o}}1 {ù}{{\` + "`" + `u}}1
+	{À}{{\` + "`" + `A}}1 {È}{{\'E}}1 {Ì}{{\` + "`" + `I}}1 {Ò}{{\` + "`" + `O}}1 {Ù}{{\` + "`" + `U}}1
+	{ä}{{\"a}}1 {ë}{{\"e}}1 {ï}{{\"i}}1 {ö}{{\"o}}1 {ü}{{\"u}}1
+	{Ä}{{\"A}}1 {Ë}{{\"E}}1 {Ï}{{\"I}}1 {Ö}{{\"O}}1 {Ü}{{\"U}}1
+	{â}{{\^a}}1 {ê}{{\^e}}1 {î}{{\^i}}1 {ô}{{\^o}}1 {û}{{\^u}}1
+	{Â}{{\^A}}1 {Ê}{{\^E}}1 {Î}{{\^I}}1 {Ô}{{\^O}}1 {Û}{{\^U}}1
+	{œ}{{\oe}}1 {Œ}{{\OE}}1 {æ}{{\ae}}1 {Æ}{{\AE}}1 {ß}{{\ss}}1
+	{ű}{{\H{u}}}1 {Ű}{{\H{U}}}1 {ő}{{\H{o}}}1 {Ő}{{\H{O}}}1
+	{ç}{{\c c}}1 {Ç}{{\c C}}1 {ø}{{\o}}1 {å}{{\r a}}1 {Å}{{\r A}}1
+	{€}{{\EUR}}1 {£}{{\pounds}}1
+<<- range .CodeCharacters>> {<<.Char>>}{{<<.Command>>}}1<<end>>
+<<- end>>
+}
+<<end>>
+
+<<- define "title">><<if .Title>><<if .Beamer>>
+\begin{frame}
+\titlepage
+\end{frame}
+<<else>>
+\maketitle
+<<end>><<end>><<end>>
+
+<<- define "front">><<if or .Dedication .Epigraph .Abstract .Keywords>>
+<<if .Beamer>>\begin{frame}
+<<end>>
+<<- with .Dedication>><<if not $.Beamer>>\clearpage
+\thispagestyle{<<$.TitlePageStyle>>}
+\vspace*{\stretch{1}}
+<<end>>\begin{center}
+\itshape
+<<.>>
+\end{center}
+<<if not $.Beamer>>\vspace*{\stretch{2}}
+\clearpage
+<<end>><<end>>
+<<- with .Epigraph>>\epigraph{<<.>>}{<<$.EpigraphSource>>}
+<<end>>
+<<- with .Abstract>>\begin{abstract}
+<<.>>
+\end{abstract}
+<<end>>
+<<- with .Keywords>>\noindent\textbf{Keywords:} <<.>>
+<<end>>
+<<- if .Beamer>>\end{frame}
+<<end>><<end>><<end>>
+
+<<- define "toc">><<if .TOC>><<if .Beamer>>\begin{frame}{\contentsname}
+\tableofcontents
+\end{frame}
+<<else>><<if .Title>>\vfill
+\thispagestyle{<<.TitlePageStyle>>}
+
+<<end>>\tableofcontents
+<<if .Features.Figures>>\listoffigures
+<<end>><<if .Features.Tables>>\listoftables
+<<end>><<if and .Listings .Features.Listings>>\lstlistoflistings
+<<end>>\clearpage
+<<end>><<end>><<end>>
+
+<<- define "chapter">>\<<.ChapterCommand>>{<<.Title>>}
+
+<<end>>
+
+<<- define "footer">><<if .Bibliography>>
+\printbibliography
+<<end>><<range .IncludeAfter>><<.>>
+<<end>>\end{document}
+<<end>>`
+
+var defaultTemplates = template.Must(newTemplate().Parse(defaultTemplateText))
+
+func newTemplate() *template.Template {
+	return template.New("latex").Delims(LeftDelim, RightDelim)
+}
+
+// DefaultTemplates returns a copy of the templates used when
+// Renderer.Templates is nil. Individual templates can be overridden by
+// parsing a new definition with the same name into the returned set, e.g.
+//
+//	t := latex.DefaultTemplates()
+//	template.Must(t.New("lstset").Parse(`\lstset{basicstyle=\ttfamily}`))
+//	renderer := &latex.Renderer{Templates: t}
+//
+// The set defines "header", "preamble", "code", "lstset", "title", "toc",
+// "chapter" and "footer". All of them are executed with a *TemplateData.
+func DefaultTemplates() *template.Template {
+	return template.Must(defaultTemplates.Clone())
+}
+
+func (r *Renderer) templates() *template.Template {
+	if r.Templates != nil {
+		return r.Templates
+	}
+	return defaultTemplates
+}
+
+func (r *Renderer) templateData(ast *bf.Node, tb titleBlock, fm frontMatter) *TemplateData {
+	class := r.documentClass()
+	if class == "" {
+		class = ClassArticle
+	}
+	var classOptions []string
+	if r.class().koma {
+		// KOMA-Script handles paragraph spacing itself.
+		classOptions = append(classOptions, "parskip=half")
+	}
+	layout := r.layout()
+	theme := r.theme()
+	classOptions = appendOptions(classOptions, layout.classOptions(r.class())...)
+	classOptions = appendOptions(classOptions, removeOptions(r.Metadata.ClassOptions, layout.offOptions()...)...)
+
+	// The renderer fields come first, then the metadata, then the title block.
+	title := string(tb.title)
+	if r.Metadata.Title != "" {
+		title = r.inlineMeta(r.Metadata.Title)
+	}
+	if r.Title != "" {
+		title = r.inlineMeta(r.Title)
+	}
+	var authors templateAuthors
+	switch {
+	case len(r.Authors) != 0:
+		authors = r.templateAuthors(r.Authors)
+	case r.Author != "":
+		authors = r.templateAuthors([]Author{{Name: r.Author}})
+	case len(r.Metadata.Authors) != 0:
+		authors = r.templateAuthors(r.Metadata.Authors)
+	default:
+		for _, a := range tb.authors {
+			authors.authors = append(authors.authors, TemplateAuthor{Name: string(a)})
+		}
+		authors.pdf = tb.pdfAuthors
+	}
+	var names []string
+	for _, a := range authors.authors {
+		name := a.Name
+		if a.Thanks != "" {
+			name += `\thanks{` + a.Thanks + `}`
+		}
+		names = append(names, name)
+	}
+	date := string(tb.date)
+	if r.Metadata.Date != "" {
+		date = r.escapeMeta(r.Metadata.Date)
+	}
+	if r.Date != "" {
+		date = r.escapeMeta(r.Date)
+	}
+	geometry := []string{"margin=1in"}
+	if len(r.Metadata.Geometry) != 0 {
+		geometry = r.Metadata.Geometry
+	}
+	geometry = append(geometry, layout.geometry()...)
+	languages := r.Languages
+	if languages == "" {
+		languages = babelLanguage(r.Metadata.Lang)
+	}
+	flags := r.Flags
+	if r.Metadata.TOC {
+		flags |= TOC
+	}
+	tocDepth := r.TOCDepth
+	if tocDepth == 0 {
+		tocDepth = r.Metadata.TOCDepth
+	}
+	secNumDepth := r.SecNumDepth
+	if secNumDepth == 0 {
+		secNumDepth = r.Metadata.SecNumDepth
+	}
+
+	data := &TemplateData{
+		Title:               title,
+		Author:              strings.Join(names, ` \and `),
+		Authors:             authors.authors,
+		Affiliations:        authors.affiliations,
+		PDFAuthor:           strings.Join(authors.pdf, ", "),
+		Subtitle:            r.inlineMeta(r.Metadata.Subtitle),
+		Date:                date,
+		Keywords:            strings.Join(fm.keywords, ", "),
+		Abstract:            fm.abstract,
+		Dedication:          fm.dedication,
+		Epigraph:            fm.epigraph,
+		EpigraphSource:      fm.epigraphSource,
+		Geometry:            strings.Join(geometry, ","),
+		LineSpacing:         layout.LineSpacing,
+		HeaderIncludes:      append(append([]string(nil), r.Metadata.HeaderIncludes...), r.Preamble.HeaderIncludes...),
+		IncludeBefore:       append(append([]string(nil), r.Metadata.IncludeBefore...), r.Preamble.IncludeBefore...),
+		IncludeAfter:        append(append([]string(nil), r.Metadata.IncludeAfter...), r.Preamble.IncludeAfter...),
+		Bibliography:        r.Metadata.Bibliography,
+		Class:               class,
+		ClassOptions:        strings.Join(classOptions, ","),
+		ChapterCommand:      r.class().titleCommand,
+		CodeEngine:          r.CodeEngine,
+		LanguageDefinitions: listingsLanguageDefinitions(ast),
+		Languages:           languages,
+		Engine:              r.Engine,
+		MainFont:            firstNonEmpty(r.MainFont, theme.MainFont),
+		SansFont:            firstNonEmpty(r.SansFont, theme.SansFont),
+		MonoFont:            firstNonEmpty(r.MonoFont, theme.MonoFont),
+		Theme:               theme,
+		CJKFont:             r.CJKFont,
+		HebrewFont:          r.HebrewFont,
+		ArabicFont:          r.ArabicFont,
+		UnicodePackages:     r.unicodePackages(ast),
+		CodeCharacters:      r.codeCharacters(ast),
+		Flags:               flags,
+		TOCDepth:            r.depth(tocDepth),
+		SecNumDepth:         r.depth(secNumDepth),
+		Version:             bf.Version,
+		Features:            r.features(ast),
+	}
+	data.PageStyle = r.pageStyle(data)
+	data.Draft = r.draft(data.Beamer())
+	header := []string{data.Title, data.Author, data.Subtitle, data.Date, data.Abstract, data.Dedication, data.Epigraph, data.EpigraphSource}
+	if data.PageStyle != nil {
+		for _, s := range append(data.PageStyle.Header, data.PageStyle.Footer...) {
+			header = append(header, s.Text)
+		}
+	}
+	if data.Draft != nil {
+		header = append(header, data.Draft.Watermark, data.Draft.Footer, data.Draft.Banner)
+	}
+	headerFeatures(&data.Features, header...)
+	return data
+}
+
+// Escape a metadata value given as plain text.
+func (r *Renderer) escapeMeta(text string) string {
+	var w bytes.Buffer
+	escapeTitle(&w, []byte(text))
+	return string(r.unicode(w.Bytes()))
+}
+
+// Render a title or a name of the metadata with the inline rules of the body,
+// such as TeX math and the script commands of the Multilingual flag. Line
+// breaks are kept, as with escapeMeta.
+func (r *Renderer) inlineMeta(text string) string {
+	inline := r.inlineRenderer()
+	for i, line := range bytes.Split(bytes.TrimSpace([]byte(text)), []byte("\n")) {
+		if i > 0 {
+			inline.w.WriteString(`\\` + "\n")
+		}
+		inline.plain(bytes.TrimSpace(line))
+	}
+	if inline.quoted {
+		inline.w.WriteByte('}')
+	}
+	r.warnings = append(r.warnings, inline.warnings...)
+	return inline.w.String()
+}
+
+func (r *Renderer) features(ast *bf.Node) Features {
+	features := Features{
+		Figures:  hasFigures(ast),
+		Tables:   r.hasTables(ast),
+		Listings: hasListings(ast),
+	}
+	if r.Flags&Multilingual != 0 {
+		features.CJK, features.Hebrew, features.Arabic = documentScripts(ast, r.metaNames()...)
+	}
+	r.usedFeatures(ast, &features)
+	return features
+}
+
+// Execute the named template. Errors are reported inline in the output, the
+// same way other rendering errors are.
+func (r *Renderer) execute(w io.Writer, name string, data *TemplateData) {
+	if err := r.templates().ExecuteTemplate(w, name, data); err != nil {
+		io.WriteString(w, "!<RENDERING ERROR: "+err.Error()+">!")
+	}
+}
+
+// Return the first of the strings that is not empty.
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
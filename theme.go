@@ -0,0 +1,181 @@
+package latex
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Theme bundles the look of a document: the colors of code and links, the
+// fonts and the style of the headings. Colors are xcolor expressions, e.g.
+// "green!40!black", which may use the colors the theme defines.
+type Theme struct {
+	// Base is the name of the theme a loaded theme starts from.
+	Base string `json:"base,omitempty"`
+
+	// Colors are the named colors the theme defines, as HTML codes, e.g.
+	// "268BD2".
+	Colors map[string]string `json:"colors,omitempty"`
+
+	// Colors of the code keywords, comments, strings and numbers. Numbers are
+	// only colored by CodeHighlight.
+	Keyword string `json:"keyword,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	String  string `json:"string,omitempty"`
+	Number  string `json:"number,omitempty"`
+
+	// LineNumbers numbers the lines of code blocks.
+	LineNumbers bool `json:"line-numbers,omitempty"`
+
+	// MintedStyle is the Pygments style used by CodeMinted, e.g. "friendly".
+	MintedStyle string `json:"minted-style,omitempty"`
+
+	// Colors of the internal links, citations and URLs.
+	LinkColor string `json:"link-color,omitempty"`
+	CiteColor string `json:"cite-color,omitempty"`
+	URLColor  string `json:"url-color,omitempty"`
+
+	// FontPackages are the font packages loaded with pdfLaTeX, e.g.
+	// "libertine". The fonts are used with XeLaTeX and LuaLaTeX unless the
+	// renderer sets its own.
+	FontPackages []string `json:"font-packages,omitempty"`
+	MainFont     string   `json:"main-font,omitempty"`
+	SansFont     string   `json:"sans-font,omitempty"`
+	MonoFont     string   `json:"mono-font,omitempty"`
+
+	// SansSerif sets the text in the sans serif font.
+	SansSerif bool `json:"sans-serif,omitempty"`
+
+	// HeadingFont are font commands added to the headings, e.g. `\sffamily`,
+	// and HeadingColor their color. They are set with titlesec, or with the
+	// font commands of KOMA-Script.
+	HeadingFont  string `json:"heading-font,omitempty"`
+	HeadingColor string `json:"heading-color,omitempty"`
+}
+
+// DefaultTheme is the theme used when none is given.
+var DefaultTheme = Themes["default"]
+
+// Themes are the named themes, which may be used as the base of loaded themes.
+var Themes = map[string]*Theme{
+	"default": {
+		Keyword:     "green!40!black",
+		Comment:     "purple!40!black",
+		String:      "orange",
+		Number:      "blue!60!black",
+		LineNumbers: true,
+		LinkColor:   "black",
+		CiteColor:   "black",
+		URLColor:    "black",
+	},
+	"print-bw": {
+		Keyword:     "black",
+		Comment:     "black!60",
+		String:      "black!80",
+		Number:      "black",
+		LineNumbers: true,
+		LinkColor:   "black",
+		CiteColor:   "black",
+		URLColor:    "black",
+	},
+	"solarized": {
+		Colors: map[string]string{
+			"SolarizedBase1":   "93A1A1",
+			"SolarizedBlue":    "268BD2",
+			"SolarizedCyan":    "2AA198",
+			"SolarizedGreen":   "859900",
+			"SolarizedMagenta": "D33682",
+			"SolarizedOrange":  "CB4B16",
+		},
+		Keyword:      "SolarizedGreen",
+		Comment:      "SolarizedBase1",
+		String:       "SolarizedCyan",
+		Number:       "SolarizedMagenta",
+		LineNumbers:  true,
+		MintedStyle:  "solarized-light",
+		LinkColor:    "SolarizedBlue",
+		CiteColor:    "SolarizedMagenta",
+		URLColor:     "SolarizedOrange",
+		HeadingColor: "SolarizedBlue",
+	},
+	"corporate": {
+		Colors: map[string]string{
+			"CorporateBlue": "1F4E79",
+			"CorporateGray": "595959",
+		},
+		Keyword:      "CorporateBlue",
+		Comment:      "CorporateGray",
+		String:       "black",
+		Number:       "black",
+		LinkColor:    "CorporateBlue",
+		CiteColor:    "CorporateBlue",
+		URLColor:     "CorporateBlue",
+		FontPackages: []string{"helvet"},
+		SansSerif:    true,
+		HeadingFont:  `\sffamily`,
+		HeadingColor: "CorporateBlue",
+	},
+}
+
+// LoadTheme reads a theme in JSON, e.g.
+//
+//	{"base": "solarized", "link-color": "SolarizedGreen"}
+//
+// The theme starts from its base, or from the default theme.
+func LoadTheme(r io.Reader) (*Theme, error) {
+	var base struct {
+		Base string `json:"base"`
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, fmt.Errorf("theme: %v", err)
+	}
+	if base.Base == "" {
+		base.Base = "default"
+	}
+	b, ok := Themes[base.Base]
+	if !ok {
+		return nil, fmt.Errorf("theme: unknown base %q", base.Base)
+	}
+
+	// Start from a copy of the base, colors and packages included.
+	theme := *b
+	theme.Colors = map[string]string{}
+	for name, value := range b.Colors {
+		theme.Colors[name] = value
+	}
+	theme.FontPackages = append([]string(nil), b.FontPackages...)
+	if err := json.Unmarshal(data, &theme); err != nil {
+		return nil, fmt.Errorf("theme: %v", err)
+	}
+	return &theme, nil
+}
+
+// LoadThemeFile reads a theme from a JSON file.
+func LoadThemeFile(name string) (*Theme, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadTheme(f)
+}
+
+// Return the theme of the renderer, or else the one named by the metadata, or
+// else the default theme.
+func (r *Renderer) theme() *Theme {
+	if r.Theme != nil {
+		return r.Theme
+	}
+	if r.Metadata.Theme != "" {
+		if t, ok := Themes[r.Metadata.Theme]; ok {
+			return t
+		}
+	}
+	return DefaultTheme
+}
@@ -0,0 +1,347 @@
+package latex
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	bf "github.com/russross/blackfriday/v2"
+)
+
+// A LaTeX replacement for a character pdfLaTeX cannot typeset directly.
+type unicodeSymbol struct {
+	command string
+	pkg     string // The package the command needs, if any.
+}
+
+// Characters that inputenc handles with the T1 and TS1 encodings, besides
+// Latin-1 and Latin Extended-A, and those the preamble declares.
+var nativeRunes = map[rune]bool{
+	0x0218: true, 0x0219: true, 0x021A: true, 0x021B: true, // Ș ș Ț ț
+	0x02C6: true, 0x02DC: true, // ˆ ˜
+	0x2013: true, 0x2014: true, 0x2016: true, // – — ‖
+	0x2018: true, 0x2019: true, 0x201A: true, 0x201C: true, 0x201D: true, 0x201E: true,
+	0x2020: true, 0x2021: true, 0x2022: true, 0x2026: true, 0x2030: true, 0x2031: true,
+	0x2039: true, 0x203A: true, 0x203B: true, 0x203D: true, 0x2044: true, 0x2052: true,
+	0x20A1: true, 0x20A4: true, 0x20A6: true, 0x20A9: true, 0x20AB: true, 0x20AC: true,
+	0x20B1: true, 0x20B2: true,
+	0x2103: true, 0x2116: true, 0x2117: true, 0x211E: true, 0x2120: true, 0x2122: true,
+	0x2126: true, 0x2127: true, 0x212E: true,
+	0x2190: true, 0x2191: true, 0x2192: true, 0x2193: true, // ← ↑ → ↓
+	0x221A: true, 0x2260: true, 0x2264: true, 0x2265: true, 0x22C5: true, // √ ≠ ≤ ≥ ⋅
+	0x2329: true, 0x232A: true, 0x25E6: true, 0x25EF: true, 0x266A: true, // 〈 〉 ◦ ◯ ♪
+}
+
+// Math symbols, by character. They are typeset with `\ensuremath`.
+var mathSymbols = map[rune]string{
+	// Arrows.
+	0x2194: `\leftrightarrow`, 0x2195: `\updownarrow`, 0x2196: `\nwarrow`, 0x2197: `\nearrow`,
+	0x2198: `\searrow`, 0x2199: `\swarrow`, 0x21A6: `\mapsto`, 0x21A9: `\hookleftarrow`,
+	0x21AA: `\hookrightarrow`, 0x21BC: `\leftharpoonup`, 0x21C0: `\rightharpoonup`,
+	0x21CC: `\rightleftharpoons`, 0x21D0: `\Leftarrow`, 0x21D1: `\Uparrow`, 0x21D2: `\Rightarrow`,
+	0x21D3: `\Downarrow`, 0x21D4: `\Leftrightarrow`, 0x21D5: `\Updownarrow`,
+	0x27F5: `\longleftarrow`, 0x27F6: `\longrightarrow`, 0x27F7: `\longleftrightarrow`,
+	0x27F8: `\Longleftarrow`, 0x27F9: `\Longrightarrow`, 0x27FA: `\Longleftrightarrow`,
+	0x27FC: `\longmapsto`,
+
+	// Mathematical operators.
+	0x2200: `\forall`, 0x2202: `\partial`, 0x2203: `\exists`, 0x2205: `\emptyset`,
+	0x2207: `\nabla`, 0x2208: `\in`, 0x2209: `\notin`, 0x220B: `\ni`, 0x220F: `\prod`,
+	0x2210: `\coprod`, 0x2211: `\sum`, 0x2212: `-`, 0x2213: `\mp`, 0x2216: `\setminus`,
+	0x2217: `\ast`, 0x2218: `\circ`, 0x2219: `\bullet`, 0x221D: `\propto`, 0x221E: `\infty`,
+	0x2220: `\angle`, 0x2223: `\mid`, 0x2225: `\parallel`, 0x2227: `\wedge`, 0x2228: `\vee`,
+	0x2229: `\cap`, 0x222A: `\cup`, 0x222B: `\int`, 0x222E: `\oint`, 0x223C: `\sim`,
+	0x2243: `\simeq`, 0x2245: `\cong`, 0x2248: `\approx`, 0x224D: `\asymp`, 0x2250: `\doteq`,
+	0x2261: `\equiv`, 0x226A: `\ll`, 0x226B: `\gg`, 0x227A: `\prec`, 0x227B: `\succ`,
+	0x2282: `\subset`, 0x2283: `\supset`, 0x2286: `\subseteq`, 0x2287: `\supseteq`,
+	0x228E: `\uplus`, 0x2291: `\sqsubseteq`, 0x2292: `\sqsupseteq`, 0x2293: `\sqcap`,
+	0x2294: `\sqcup`, 0x2295: `\oplus`, 0x2296: `\ominus`, 0x2297: `\otimes`, 0x2298: `\oslash`,
+	0x2299: `\odot`, 0x22A2: `\vdash`, 0x22A3: `\dashv`, 0x22A4: `\top`, 0x22A5: `\perp`,
+	0x22A8: `\models`, 0x22C0: `\bigwedge`, 0x22C1: `\bigvee`, 0x22C2: `\bigcap`,
+	0x22C3: `\bigcup`, 0x22C4: `\diamond`, 0x22C6: `\star`, 0x22EE: `\vdots`, 0x22EF: `\cdots`,
+	0x22F1: `\ddots`, 0x2308: `\lceil`, 0x2309: `\rceil`, 0x230A: `\lfloor`, 0x230B: `\rfloor`,
+	0x27E8: `\langle`, 0x27E9: `\rangle`,
+
+	// Letter-like symbols.
+	0x2032: `\prime`, 0x2033: `\prime\prime`, 0x2034: `\prime\prime\prime`,
+	0x210F: `\hbar`, 0x2111: `\Im`, 0x2113: `\ell`, 0x2118: `\wp`, 0x211C: `\Re`,
+	0x2135: `\aleph`,
+
+	// Fractions.
+	0x2153: `\frac{1}{3}`, 0x2154: `\frac{2}{3}`, 0x2155: `\frac{1}{5}`, 0x2156: `\frac{2}{5}`,
+	0x2157: `\frac{3}{5}`, 0x2158: `\frac{4}{5}`, 0x2159: `\frac{1}{6}`, 0x215A: `\frac{5}{6}`,
+	0x215B: `\frac{1}{8}`, 0x215C: `\frac{3}{8}`, 0x215D: `\frac{5}{8}`, 0x215E: `\frac{7}{8}`,
+
+	// Shapes and suits.
+	0x25B3: `\triangle`, 0x25B7: `\triangleright`, 0x25C1: `\triangleleft`,
+	0x25CB: `\bigcirc`, 0x2660: `\spadesuit`, 0x2661: `\heartsuit`, 0x2662: `\diamondsuit`,
+	0x2663: `\clubsuit`, 0x2665: `\heartsuit`, 0x2666: `\diamondsuit`, 0x266D: `\flat`,
+	0x266E: `\natural`, 0x266F: `\sharp`,
+}
+
+// Math symbols from amssymb.
+var amsSymbols = map[rune]string{
+	0x2204: `\nexists`, 0x2234: `\therefore`, 0x2235: `\because`, 0x2241: `\nsim`,
+	0x2247: `\ncong`, 0x2252: `\fallingdotseq`, 0x2266: `\leqq`, 0x2267: `\geqq`,
+	0x2272: `\lesssim`, 0x2273: `\gtrsim`, 0x2288: `\nsubseteq`, 0x2289: `\nsupseteq`,
+	0x228A: `\subsetneq`, 0x228B: `\supsetneq`, 0x22A0: `\boxtimes`, 0x22A9: `\Vdash`,
+	0x22B2: `\lhd`, 0x22B3: `\rhd`, 0x22C9: `\ltimes`, 0x22CA: `\rtimes`,
+	0x2102: `\mathbb{C}`, 0x2115: `\mathbb{N}`, 0x2119: `\mathbb{P}`, 0x211A: `\mathbb{Q}`,
+	0x211D: `\mathbb{R}`, 0x2124: `\mathbb{Z}`,
+	0x21A0: `\twoheadrightarrow`, 0x21C4: `\rightleftarrows`, 0x21DD: `\rightsquigarrow`,
+	0x25A0: `\blacksquare`, 0x25A1: `\square`, 0x25B2: `\blacktriangle`,
+	0x25B6: `\blacktriangleright`, 0x25BC: `\blacktriangledown`, 0x25BD: `\triangledown`,
+	0x25C0: `\blacktriangleleft`, 0x25C6: `\blacklozenge`, 0x25CA: `\lozenge`,
+	0x2605: `\bigstar`, 0x2713: `\checkmark`,
+}
+
+// Dingbats from pifont, by their number in the Zapf Dingbats font.
+var dingbats = map[rune]int{
+	0x260E: 37, 0x261B: 42, 0x261E: 43, 0x2605: 72, 0x2606: 73, 0x25CF: 108, 0x25D7: 119,
+	0x2701: 33, 0x2702: 34, 0x2704: 36, 0x2708: 40, 0x2709: 41, 0x270C: 44, 0x270D: 45,
+	0x270E: 46, 0x270F: 47, 0x2710: 48, 0x2711: 49, 0x2712: 50, 0x2713: 51, 0x2714: 52,
+	0x2715: 53, 0x2716: 54, 0x2717: 55, 0x2718: 56, 0x2719: 57, 0x271A: 58, 0x2720: 64,
+	0x2726: 70, 0x2727: 71, 0x2729: 73, 0x272A: 74, 0x2730: 80, 0x2731: 81, 0x2736: 86,
+	0x273D: 93, 0x2740: 96, 0x2744: 100, 0x274F: 111, 0x2751: 113, 0x2756: 118,
+	0x275B: 123, 0x275C: 124, 0x275D: 125, 0x275E: 126, 0x2776: 182, 0x2777: 183,
+	0x2778: 184, 0x2779: 185, 0x277A: 186, 0x277B: 187, 0x277C: 188, 0x277D: 189,
+	0x277E: 190, 0x277F: 191, 0x2794: 212, 0x2798: 216, 0x279C: 220, 0x27A2: 226,
+	0x27A4: 228, 0x27B2: 242,
+}
+
+// Text commands, by character.
+var textSymbols = map[rune]string{
+	0x0192: `\textflorin{}`,
+	0x2002: `\enspace{}`, 0x2003: `\quad{}`, 0x2007: `\enspace{}`, 0x2009: `\,`, 0x200A: `\,`,
+	0x200B: `\hspace{0pt}`, 0x200C: `{}`, 0x200D: `{}`, 0x202F: `\,`, 0x2060: `{}`, 0xFEFF: ``,
+	0x2010: `-`, 0x2011: `\mbox{-}`, 0x2012: `\textendash{}`, 0x2015: `\textemdash{}`,
+	0x201B: `\textquoteleft{}`, 0x201F: `\textquotedblleft{}`, 0x2023: `\textbullet{}`,
+	0x2024: `.`, 0x2025: `..`, 0x2027: `\textperiodcentered{}`,
+	0xFB00: `ff`, 0xFB01: `fi`, 0xFB02: `fl`, 0xFB03: `ffi`, 0xFB04: `ffl`,
+}
+
+// Greek letters, in alphabetical order. Capitals that look like Latin letters
+// have no command of their own.
+var greekLetters = []struct {
+	lower, upper rune
+	name         string
+}{
+	{0x03B1, 0x0391, "alpha"}, {0x03B2, 0x0392, "beta"}, {0x03B3, 0x0393, "gamma"},
+	{0x03B4, 0x0394, "delta"}, {0x03B5, 0x0395, "epsilon"}, {0x03B6, 0x0396, "zeta"},
+	{0x03B7, 0x0397, "eta"}, {0x03B8, 0x0398, "theta"}, {0x03B9, 0x0399, "iota"},
+	{0x03BA, 0x039A, "kappa"}, {0x03BB, 0x039B, "lambda"}, {0x03BC, 0x039C, "mu"},
+	{0x03BD, 0x039D, "nu"}, {0x03BE, 0x039E, "xi"}, {0x03BF, 0x039F, "omicron"},
+	{0x03C0, 0x03A0, "pi"}, {0x03C1, 0x03A1, "rho"}, {0x03C3, 0x03A3, "sigma"},
+	{0x03C4, 0x03A4, "tau"}, {0x03C5, 0x03A5, "upsilon"}, {0x03C6, 0x03A6, "phi"},
+	{0x03C7, 0x03A7, "chi"}, {0x03C8, 0x03A8, "psi"}, {0x03C9, 0x03A9, "omega"},
+}
+
+var greekLatinCapitals = map[string]string{
+	"alpha": "A", "beta": "B", "epsilon": "E", "zeta": "Z", "eta": "H", "iota": "I",
+	"kappa": "K", "mu": "M", "nu": "N", "omicron": "O", "rho": "P", "tau": "T", "chi": "X",
+}
+
+// The mapping of the characters pdfLaTeX does not know, generated from the
+// tables above.
+var unicodeSymbols = map[rune]unicodeSymbol{}
+
+func init() {
+	for _, g := range greekLetters {
+		lower := `\` + g.name
+		if g.name == "omicron" {
+			lower = "o"
+		}
+		unicodeSymbols[g.lower] = unicodeSymbol{command: `\ensuremath{` + lower + `}`}
+		upper := `\mathrm{` + greekLatinCapitals[g.name] + `}`
+		if greekLatinCapitals[g.name] == "" {
+			upper = `\` + string(g.name[0]-'a'+'A') + g.name[1:]
+		}
+		unicodeSymbols[g.upper] = unicodeSymbol{command: `\ensuremath{` + upper + `}`}
+	}
+	for c, name := range map[rune]string{
+		0x03C2: `\varsigma`, 0x03D1: `\vartheta`, 0x03D5: `\phi`, 0x03D6: `\varpi`,
+		0x03F1: `\varrho`, 0x03F5: `\epsilon`, 0x03C6: `\varphi`, 0x03B5: `\varepsilon`,
+	} {
+		unicodeSymbols[c] = unicodeSymbol{command: `\ensuremath{` + name + `}`}
+	}
+	for c, name := range mathSymbols {
+		unicodeSymbols[c] = unicodeSymbol{command: `\ensuremath{` + name + `}`}
+	}
+	for c, name := range amsSymbols {
+		unicodeSymbols[c] = unicodeSymbol{command: `\ensuremath{` + name + `}`, pkg: "amssymb"}
+	}
+	for c, n := range dingbats {
+		if _, ok := unicodeSymbols[c]; !ok {
+			unicodeSymbols[c] = unicodeSymbol{command: `\ding{` + strconv.Itoa(n) + `}`, pkg: "pifont"}
+		}
+	}
+	for c, command := range textSymbols {
+		unicodeSymbols[c] = unicodeSymbol{command: command}
+	}
+}
+
+// Report whether pdfLaTeX typesets the character without help.
+func isNative(c rune) bool {
+	return c < 0x180 || nativeRunes[c] || c >= 0x2500 && c < 0x25A0
+}
+
+// Replace the characters of text that pdfLaTeX cannot typeset by LaTeX
+// commands. Text must already be escaped. Characters without a replacement
+// are reported and replaced by UnicodePlaceholder. Unicode engines need no
+// replacement.
+func (r *Renderer) unicode(text []byte) []byte {
+	if r.Engine.unicode() {
+		return text
+	}
+	var w bytes.Buffer
+	org := 0
+	for i := 0; i < len(text); {
+		c, size := utf8.DecodeRune(text[i:])
+		if isNative(c) {
+			i += size
+			continue
+		}
+		w.Write(text[org:i])
+		if symbol, ok := unicodeSymbols[c]; ok {
+			w.WriteString(symbol.command)
+		} else {
+			if !r.unmapped[c] {
+				if r.unmapped == nil {
+					r.unmapped = map[rune]bool{}
+				}
+				r.unmapped[c] = true
+				r.warn("unsupported character %q (U+%04X)", c, c)
+			}
+			w.WriteString(r.UnicodePlaceholder)
+		}
+		i += size
+		org = i
+	}
+	if org == 0 {
+		return text
+	}
+	w.Write(text[org:])
+	return w.Bytes()
+}
+
+// Return the packages needed by the characters of the document and of the
+// renderer fields, sorted.
+func (r *Renderer) unicodePackages(ast *bf.Node) []string {
+	if r.Engine.unicode() {
+		return nil
+	}
+	return unicodePackages(ast, r.Author)
+}
+
+// Return the packages needed by the characters of the document and of the
+// given strings, sorted. Box-drawing characters need pmboxdraw.
+func unicodePackages(ast *bf.Node, extra ...string) []string {
+	needed := map[string]bool{}
+	scan := func(text []byte) {
+		for _, c := range string(text) {
+			switch {
+			case c >= 0x2500 && c < 0x25A0:
+				needed["pmboxdraw"] = true
+			case !isNative(c) && unicodeSymbols[c].pkg != "":
+				needed[unicodeSymbols[c].pkg] = true
+			}
+		}
+	}
+	for _, s := range extra {
+		scan([]byte(s))
+	}
+	ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		switch node.Type {
+		case bf.Text, bf.Code, bf.CodeBlock:
+			scan(node.Literal)
+		case bf.Image:
+			scan(node.LinkData.Title)
+		}
+		return bf.GoToNext
+	})
+
+	var packages []string
+	for p := range needed {
+		packages = append(packages, p)
+	}
+	sort.Strings(packages)
+	return packages
+}
+
+// CodeCharacter is a character of the code of the document that pdfLaTeX
+// needs help with. Listings gets a literate replacement for it; the other
+// code engines rely on inputenc, with a declaration for characters that are
+// not native.
+type CodeCharacter struct {
+	Char string
+
+	// Code is the hexadecimal code point, e.g. "2200".
+	Code string
+
+	// Command typesets the character; it is the character itself if Native.
+	Command string
+	Native  bool
+}
+
+// Characters of the literate replacements of the default listings setup.
+const listingsLiterate = "áéíóúÁÉÍÓÚàèìòùÀÈÌÒÙäëïöüÄËÏÖÜâêîôûÂÊÎÔÛœŒæÆßűŰőŐçÇøåÅ€£"
+
+// Return the non-ASCII characters of the code spans and blocks, sorted.
+// Characters without a replacement are reported and replaced by
+// UnicodePlaceholder. Unicode engines need no help.
+func (r *Renderer) codeCharacters(ast *bf.Node) []CodeCharacter {
+	if r.Engine.unicode() {
+		return nil
+	}
+	found := map[rune]bool{}
+	ast.Walk(func(node *bf.Node, entering bool) bf.WalkStatus {
+		switch node.Type {
+		case bf.Code:
+			if bytes.HasPrefix(node.Literal, []byte("$$ ")) {
+				return bf.GoToNext
+			}
+		case bf.CodeBlock:
+			if lang, _ := codeInfo(node.Info); string(lang) == "math" {
+				return bf.GoToNext
+			}
+		default:
+			return bf.GoToNext
+		}
+		for _, c := range string(node.Literal) {
+			if c >= utf8.RuneSelf && !strings.ContainsRune(listingsLiterate, c) {
+				found[c] = true
+			}
+		}
+		return bf.GoToNext
+	})
+
+	var runes []rune
+	for c := range found {
+		runes = append(runes, c)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	var chars []CodeCharacter
+	for _, c := range runes {
+		char := CodeCharacter{Char: string(c), Code: fmt.Sprintf("%04X", c)}
+		switch symbol, ok := unicodeSymbols[c]; {
+		case isNative(c):
+			char.Command, char.Native = string(c), true
+		case ok:
+			char.Command = symbol.command
+		default:
+			if !r.unmapped[c] {
+				if r.unmapped == nil {
+					r.unmapped = map[rune]bool{}
+				}
+				r.unmapped[c] = true
+				r.warn("unsupported character %q (U+%04X)", c, c)
+			}
+			char.Command = r.UnicodePlaceholder
+		}
+		chars = append(chars, char)
+	}
+	return chars
+}